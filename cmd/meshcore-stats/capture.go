@@ -0,0 +1,158 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/watsoncj/meshcore-stats/internal/meshcore"
+	_ "modernc.org/sqlite"
+)
+
+const captureSchema = `
+CREATE TABLE IF NOT EXISTS packets (
+	id           INTEGER PRIMARY KEY,
+	received_at  INTEGER NOT NULL, -- unix milliseconds
+	sender       TEXT NOT NULL,    -- first hop name, path hash, or "direct"
+	rssi         INTEGER NOT NULL,
+	snr          REAL NOT NULL,
+	route_type   INTEGER NOT NULL,
+	payload_type INTEGER NOT NULL,
+	size         INTEGER NOT NULL, -- payload bytes
+	hops         INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS packets_received_at ON packets (received_at);
+`
+
+// capturedPacket is one overheard packet waiting to be written.
+type capturedPacket struct {
+	at     time.Time
+	sender string
+	entry  *meshcore.RxLogEntry
+}
+
+func captureDBCmd() {
+	fs := flag.NewFlagSet("capture-db", flag.ExitOnError)
+	port := fs.String("port", "/dev/ttyACM0", "Serial port for MeshCore radio")
+	baud := fs.Int("baud", 115200, "Baud rate")
+	dbPath := fs.String("db", "", "SQLite database file to append packets to")
+	batch := fs.Int("batch", 100, "Packets per insert transaction")
+	flushEvery := fs.Duration("flush", 10*time.Second, "Maximum time packets are buffered before being written")
+	fs.Parse(os.Args[2:])
+
+	if *dbPath == "" {
+		fmt.Println("Usage: meshcore-stats capture-db -db mesh.db [-port /dev/ttyACM0]")
+		os.Exit(1)
+	}
+
+	db, err := sql.Open("sqlite", *dbPath)
+	if err != nil {
+		log.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(captureSchema); err != nil {
+		log.Fatalf("Failed to create schema: %v", err)
+	}
+
+	log.Printf("Opening serial port %s at %d baud", *port, *baud)
+	radio, err := meshcore.Open(*port, *baud)
+	if err != nil {
+		log.Fatalf("Failed to open radio: %v", err)
+	}
+	defer radio.Close()
+
+	// Contacts let first hops be recorded by name; without them the raw
+	// path hash is stored instead.
+	if info, err := radio.AppStart(); err != nil {
+		log.Printf("AppStart failed, senders will be path hashes: %v", err)
+	} else if contacts, err := radio.GetContacts(); err != nil {
+		log.Printf("Getting contacts failed, senders will be path hashes: %v", err)
+	} else {
+		radio.SetContacts(contacts)
+		radio.AddSelfToContacts(info)
+		log.Printf("Resolving senders against %d contacts", len(contacts))
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+
+	var pending []capturedPacket
+	var total int
+	lastFlush := time.Now()
+	flush := func() {
+		if len(pending) == 0 {
+			return
+		}
+		if err := insertPackets(db, pending); err != nil {
+			log.Printf("Error writing %d packets: %v", len(pending), err)
+			return
+		}
+		total += len(pending)
+		pending = pending[:0]
+		lastFlush = time.Now()
+	}
+
+	log.Printf("Capturing overheard packets to %s", *dbPath)
+	for {
+		select {
+		case <-stop:
+			flush()
+			log.Printf("Stopped after writing %d packets", total)
+			return
+		default:
+		}
+
+		data, err := radio.WaitForPush(time.Second)
+		switch {
+		case errors.Is(err, meshcore.ErrReadTimeout):
+		case err != nil:
+			log.Printf("Error reading from radio: %v", err)
+			if isSerialError(err) {
+				flush()
+				if rerr := radio.Reconnect(); rerr != nil {
+					log.Printf("Reconnect failed: %v", rerr)
+					time.Sleep(5 * time.Second)
+				}
+			}
+		case len(data) > 0 && data[0] == meshcore.PushCodeLogRxData:
+			if e, err := meshcore.ParseLogRxData(data); err == nil {
+				pending = append(pending, capturedPacket{time.Now(), radio.RxOrigin(e), e})
+			}
+		}
+
+		if len(pending) >= *batch || time.Since(lastFlush) >= *flushEvery {
+			flush()
+		}
+	}
+}
+
+// insertPackets writes packets in a single transaction.
+func insertPackets(db *sql.DB, packets []capturedPacket) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(`INSERT INTO packets
+		(received_at, sender, rssi, snr, route_type, payload_type, size, hops)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+	for _, p := range packets {
+		e := p.entry
+		if _, err := stmt.Exec(p.at.UnixMilli(), p.sender, e.RSSI, e.SNR,
+			e.RouteType, e.PayloadType, e.PayloadSize, e.PathLen); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/watsoncj/meshcore-stats/internal/meshcore"
+)
+
+// systemControlSocket is the control socket of an exporter run as a system
+// service, in the directory systemd creates for RuntimeDirectory=meshcore-stats.
+const systemControlSocket = "/run/meshcore-stats/control.sock"
+
+// defaultControlSocket is where a running exporter accepts commands from the
+// get-region, set-region, reboot and advert subcommands, so they can reach
+// the radio while the exporter holds its port: the user's private runtime
+// directory when there is one, and otherwise systemControlSocket.
+var defaultControlSocket = controlSocketPaths()[0]
+
+// controlSocketPaths lists where an exporter using the default socket may be
+// listening, so a subcommand run from a login session, which has a runtime
+// directory, still finds one run as a service, which doesn't.
+func controlSocketPaths() []string {
+	var paths []string
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		paths = append(paths, filepath.Join(dir, "meshcore-stats.sock"))
+	}
+	return append(paths, systemControlSocket)
+}
+
+// radioOps is held for the whole of each collection pass and each control
+// command, so a command's exchanges with the radio never land in the middle
+// of a pass (between a login and its reply, say) or another command.
+var radioOps sync.Mutex
+
+// controlOp is a subcommand's work on an open radio. Progress goes to l.
+type controlOp func(radio *meshcore.Radio, l *log.Logger) error
+
+// controlRequest is a subcommand with its flags already parsed and
+// validated, as sent over the control socket. One JSON object per line.
+type controlRequest struct {
+	Command string `json:"command"`
+	Preset  string `json:"preset,omitempty"`   // set-region: region and preset, e.g. "EU-LongFast"
+	TxPower int    `json:"tx_power,omitempty"` // set-region: 0 for the default
+	Flood   bool   `json:"flood,omitempty"`    // advert
+}
+
+// controlResponse is a line sent back to the subcommand: either a line of
+// its progress output, or the final result.
+type controlResponse struct {
+	Log   string `json:"log,omitempty"`
+	Done  bool   `json:"done,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+func (req controlRequest) op() (controlOp, error) {
+	switch req.Command {
+	case "set-region":
+		r, ok := meshcore.LookupPreset(req.Preset)
+		if !ok {
+			return nil, fmt.Errorf("unknown region or preset: %s", req.Preset)
+		}
+		return setRegionOp(r, req.TxPower), nil
+	case "get-region":
+		return getRegionOp, nil
+	case "advert":
+		return advertOp(req.Flood), nil
+	case "reboot":
+		return rebootOp, nil
+	default:
+		return nil, fmt.Errorf("unknown control command %q", req.Command)
+	}
+}
+
+// runOnRadio runs req through the exporter listening on socket if there is
+// one, and otherwise on the radio at port, exiting on failure.
+func runOnRadio(port string, baud int, socket string, req controlRequest) {
+	var sockets []string
+	switch socket {
+	case "":
+	case defaultControlSocket:
+		sockets = controlSocketPaths()
+	default:
+		sockets = []string{socket}
+	}
+	for _, socket := range sockets {
+		conn, err := net.DialTimeout("unix", socket, time.Second)
+		if err == nil {
+			log.Printf("Sending %s to the running exporter at %s", req.Command, socket)
+			if err := forwardControl(conn, req); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+	}
+
+	op, err := req.op()
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Opening serial port %s at %d baud", port, baud)
+	radio, err := meshcore.Open(port, baud)
+	if err != nil {
+		log.Fatalf("Failed to open radio: %v", err)
+	}
+	defer radio.Close()
+	if err := op(radio, log.Default()); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// forwardControl sends req over conn and relays the exporter's output until
+// the result arrives.
+func forwardControl(conn net.Conn, req controlRequest) error {
+	defer conn.Close()
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return fmt.Errorf("sending request: %w", err)
+	}
+	dec := json.NewDecoder(conn)
+	for {
+		var resp controlResponse
+		if err := dec.Decode(&resp); err != nil {
+			return fmt.Errorf("reading response: %w", err)
+		}
+		if resp.Log != "" {
+			log.Print(resp.Log)
+		}
+		if resp.Done {
+			if resp.Error != "" {
+				return errors.New(resp.Error)
+			}
+			return nil
+		}
+	}
+}
+
+// serveControl accepts control requests on a Unix socket at path and runs
+// them on radio, one at a time between collection passes. Only the owner
+// can connect. A socket left behind by an exporter that
+// didn't shut down cleanly is replaced; one still answering is an error.
+func serveControl(path string, radio *meshcore.Radio) error {
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return fmt.Errorf("another exporter is already listening on %s", path)
+	}
+	ln, err := listenPrivate(path)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go handleControl(conn, radio)
+		}
+	}()
+	return nil
+}
+
+// listenPrivate listens on a Unix socket at path that only the owner can
+// connect to. The socket is made in a private directory and moved into place
+// once its mode is set, so it is never reachable with the umask's looser
+// permissions.
+func listenPrivate(path string) (net.Listener, error) {
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".meshcore-stats-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	tmp := filepath.Join(dir, "control.sock")
+	ln, err := net.Listen("unix", tmp)
+	if err != nil {
+		return nil, err
+	}
+	// The socket is removed at its final path on shutdown instead.
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	if err := os.Chmod(tmp, 0o600); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+func handleControl(conn net.Conn, radio *meshcore.Radio) {
+	defer conn.Close()
+	enc := json.NewEncoder(conn)
+	done := func(err error) {
+		resp := controlResponse{Done: true}
+		if err != nil {
+			resp.Error = err.Error()
+		}
+		enc.Encode(resp)
+	}
+
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err != nil {
+		return
+	}
+	var req controlRequest
+	if err := json.Unmarshal(line, &req); err != nil {
+		done(fmt.Errorf("invalid request: %w", err))
+		return
+	}
+	op, err := req.op()
+	if err != nil {
+		done(err)
+		return
+	}
+	radioOps.Lock()
+	defer radioOps.Unlock()
+	slog.Info("Running control command", "command", req.Command)
+	done(op(radio, log.New(controlLog{enc}, "", 0)))
+}
+
+// controlLog sends each line written to it as a log response.
+type controlLog struct {
+	enc *json.Encoder
+}
+
+func (c controlLog) Write(p []byte) (int, error) {
+	if err := c.enc.Encode(controlResponse{Log: strings.TrimSuffix(string(p), "\n")}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/watsoncj/meshcore-stats/internal/meshcore"
+)
+
+func exportContactsCmd() {
+	fs := flag.NewFlagSet("export-contacts", flag.ExitOnError)
+	port := fs.String("port", "/dev/ttyACM0", "Serial port for MeshCore radio")
+	baud := fs.Int("baud", 115200, "Baud rate")
+	format := fs.String("format", "json", "Output format: json or csv")
+	out := fs.String("out", "", "File to write; stdout when empty")
+	fs.Parse(os.Args[2:])
+
+	var write func(io.Writer, []meshcore.Contact) error
+	switch *format {
+	case "json":
+		write = writeContactsJSON
+	case "csv":
+		write = writeContactsCSV
+	default:
+		fmt.Println("Usage: meshcore-stats export-contacts -format json|csv [-out contacts.json] [-port /dev/ttyACM0]")
+		os.Exit(1)
+	}
+
+	log.Printf("Opening serial port %s at %d baud", *port, *baud)
+	radio, err := meshcore.Open(*port, *baud)
+	if err != nil {
+		log.Fatalf("Failed to open radio: %v", err)
+	}
+	defer radio.Close()
+
+	if _, err := radio.AppStart(); err != nil {
+		log.Fatalf("Failed to start app: %v", err)
+	}
+	contacts, err := radio.GetContacts()
+	if err != nil {
+		log.Fatalf("Failed to get contacts: %v", err)
+	}
+
+	w := io.Writer(os.Stdout)
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			log.Fatalf("Failed to create %s: %v", *out, err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := write(w, contacts); err != nil {
+		log.Fatalf("Failed to write contacts: %v", err)
+	}
+	if *out != "" {
+		log.Printf("Exported %d contacts to %s", len(contacts), *out)
+	}
+}
+
+// writeContactsJSON writes contacts in the -contacts-cache format, so an
+// export can also seed the cache.
+func writeContactsJSON(w io.Writer, contacts []meshcore.Contact) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(contacts)
+}
+
+// writeContactsCSV writes one row per contact with the same columns as the
+// JSON export, plus the type's name.
+func writeContactsCSV(w io.Writer, contacts []meshcore.Contact) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"name", "pub_key", "type", "type_name", "flags", "out_path_len", "lat", "lon"})
+	for _, c := range contacts {
+		cw.Write([]string{
+			c.Name,
+			hex.EncodeToString(c.PubKey[:]),
+			strconv.Itoa(int(c.Type)),
+			meshcore.ContactTypeName(c.Type),
+			strconv.Itoa(int(c.Flags)),
+			strconv.Itoa(int(c.OutPathLen)),
+			strconv.FormatFloat(c.Lat, 'f', 6, 64),
+			strconv.FormatFloat(c.Lon, 'f', 6, 64),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// healthState tracks the last successful scrape for /healthz and /readyz.
+// In local mode it is recorded where meshcore_up is set to 1, so the
+// endpoints and the metric agree about whether the radio is reachable; in
+// remote mode it is recorded for every status response from a repeater.
+type healthState struct {
+	mu          sync.Mutex
+	interval    time.Duration
+	lastSuccess time.Time
+}
+
+var health = &healthState{}
+
+// succeeded records a successful scrape.
+func (h *healthState) succeeded() {
+	h.mu.Lock()
+	h.lastSuccess = time.Now()
+	h.mu.Unlock()
+}
+
+func (h *healthState) last() time.Time {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.lastSuccess
+}
+
+// healthz reports 200 while a scrape has succeeded within the last two
+// intervals, and 503 once the radio has gone quiet for longer.
+func (h *healthState) healthz(w http.ResponseWriter, r *http.Request) {
+	last := h.last()
+	if last.IsZero() || time.Since(last) > 2*h.interval {
+		http.Error(w, "no successful scrape in the last "+(2*h.interval).String(), http.StatusServiceUnavailable)
+		return
+	}
+	w.Write([]byte("ok\n"))
+}
+
+// readyz reports 200 once the first scrape has succeeded.
+func (h *healthState) readyz(w http.ResponseWriter, r *http.Request) {
+	if h.last().IsZero() {
+		http.Error(w, "waiting for the first successful scrape", http.StatusServiceUnavailable)
+		return
+	}
+	w.Write([]byte("ok\n"))
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/watsoncj/meshcore-stats/internal/meshcore"
+)
+
+// influxWriter posts stats to an InfluxDB write endpoint in line protocol,
+// for -output influx. url is the full write URL, e.g.
+// http://host:8086/write?db=meshcore or an InfluxDB 2 /api/v2/write URL with
+// org and bucket, in which case token authenticates.
+type influxWriter struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+// influx is the writer for -output influx; nil when serving Prometheus.
+var influx *influxWriter
+
+var influxTagEscaper = strings.NewReplacer(",", `\,`, " ", `\ `, "=", `\=`)
+
+// write sends one point per stats type for node, skipping nil ones.
+func (w *influxWriter) write(node string, core *meshcore.StatsCore, radio *meshcore.StatsRadio, packets *meshcore.StatsPackets) error {
+	var b bytes.Buffer
+	ts := time.Now().UnixNano()
+	tag := influxTagEscaper.Replace(node)
+	if core != nil {
+		fmt.Fprintf(&b, "meshcore_core,node=%s battery_mv=%di,uptime_secs=%di,error_flags=%di,queue_len=%di",
+			tag, core.BatteryMV, core.UptimeSecs, core.Errors, core.QueueLen)
+		if core.HasTemp {
+			fmt.Fprintf(&b, ",temperature_c=%g", core.TemperatureC)
+		}
+		fmt.Fprintf(&b, " %d\n", ts)
+	}
+	if radio != nil {
+		fmt.Fprintf(&b, "meshcore_radio,node=%s noise_floor_dbm=%di,last_rssi_dbm=%di,last_snr_db=%g,tx_air_secs=%di,rx_air_secs=%di %d\n",
+			tag, radio.NoiseFloor, radio.LastRSSI, radio.LastSNR, radio.TxAirSecs, radio.RxAirSecs, ts)
+	}
+	if packets != nil {
+		fmt.Fprintf(&b, "meshcore_packets,node=%s recv=%di,sent=%di,flood_tx=%di,direct_tx=%di,flood_rx=%di,direct_rx=%di %d\n",
+			tag, packets.Recv, packets.Sent, packets.FloodTx, packets.DirectTx, packets.FloodRx, packets.DirectRx, ts)
+	}
+	if b.Len() == 0 {
+		return nil
+	}
+
+	req, err := http.NewRequest(http.MethodPost, w.url, &b)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if w.token != "" {
+		req.Header.Set("Authorization", "Token "+w.token)
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("influx write returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// writeInflux writes to the configured InfluxDB, if any, logging failures so
+// collection carries on.
+func writeInflux(node string, core *meshcore.StatsCore, radio *meshcore.StatsRadio, packets *meshcore.StatsPackets) {
+	if influx == nil {
+		return
+	}
+	if err := influx.write(node, core, radio, packets); err != nil {
+		slog.Error("Error writing to InfluxDB", "node", node, "err", err)
+	}
+}
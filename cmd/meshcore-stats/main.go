@@ -1,73 +1,620 @@
 package main
 
 import (
+	"context"
+	"encoding/hex"
+	"errors"
 	"flag"
 	"fmt"
+	"io/fs"
 	"log"
+	"log/slog"
+	"maps"
 	"net/http"
 	"os"
+	"os/signal"
+	"runtime"
+	"slices"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"syscall"
+	"text/tabwriter"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/watsoncj/meshcore-stats/internal/meshcore"
 	"github.com/watsoncj/meshcore-stats/internal/metrics"
 )
 
+// version and commit identify the build and are set with -ldflags, e.g.
+// -X main.version=v1.2.0 -X main.commit=abc1234 (see the Makefile).
+var (
+	version = "dev"
+	commit  = "unknown"
+)
+
 func main() {
-	if len(os.Args) > 1 && os.Args[1] == "set-region" {
-		setRegionCmd()
-		return
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "set-region":
+			setRegionCmd()
+			return
+		case "get-region":
+			getRegionCmd()
+			return
+		case "set-advert-interval":
+			setAdvertIntervalCmd()
+			return
+		case "raw":
+			rawCmd()
+			return
+		case "contacts":
+			contactsCmd()
+			return
+		case "export-contacts":
+			exportContactsCmd()
+			return
+		case "advert":
+			advertCmd()
+			return
+		case "reboot":
+			rebootCmd()
+			return
+		case "send-text":
+			sendTextCmd()
+			return
+		case "capture-db":
+			captureDBCmd()
+			return
+		}
 	}
 
-	port := flag.String("port", "/dev/ttyACM0", "Serial port for MeshCore radio")
+	port := flag.String("port", "/dev/ttyACM0", "Serial port for MeshCore radio, or host:port with -transport tcp")
 	baud := flag.Int("baud", 115200, "Baud rate")
+	transport := flag.String("transport", "serial", "How to reach the radio: serial, tcp or ble")
+	device := flag.String("device", "", "BLE name of the companion radio with -transport ble, e.g. MeshCore-1A2B3C4D")
+	capture := flag.String("capture", "", "Append every frame received from the radio to this file, for -replay or bug reports")
+	replay := flag.String("replay", "", "Play back radio frames from this capture file instead of opening a radio")
 	addr := flag.String("addr", ":9200", "Address to expose metrics on")
+	tlsCert := flag.String("tls-cert", "", "PEM certificate to serve metrics over HTTPS with; requires -tls-pem")
+	tlsKey := flag.String("tls-pem", "", "PEM private key for -tls-cert")
+	metricsUser := flag.String("metrics-user", "", "Require HTTP basic auth with this user name for /metrics and /snapshot")
+	metricsPass := flag.String("metrics-pass", "", "Password for -metrics-user")
+	output := flag.String("output", "prometheus", "Where metrics go: prometheus (serve -addr) or influx (write to -influx-url)")
+	influxURL := flag.String("influx-url", "", "InfluxDB write URL for -output influx, e.g. http://localhost:8086/write?db=meshcore")
+	influxToken := flag.String("influx-token", "", "API token for InfluxDB 2 write URLs")
 	interval := flag.Duration("interval", 10*time.Minute, "Scrape interval")
-	repeater := flag.String("repeater", "", "Repeater name to login and query stats from")
-	password := flag.String("password", "", "Password for repeater login")
+	collectMode := flag.String("collect-mode", "push", "push polls the radio every -interval; pull (local mode only) reads it when /metrics is scraped")
+	repeater := flag.String("repeater", "", "Repeater name, unique name prefix, or contact index to login and query stats from")
+	repeaters := flag.String("repeaters", "", "Comma-separated repeaters to poll in turn, each optionally name:password (falls back to -password)")
+	var passwords passwordList
+	flag.Var(&passwords, "password", "Password for repeater login; repeat to try several in order during a rotation")
+	loginDebounce := flag.Int("login-debounce", 1, "Consecutive observations required before meshcore_login_status changes")
+	readTimeout := flag.Duration("read-timeout", meshcore.DefaultReadTimeout, "How long to wait for the radio on each read before it counts as a timeout")
+	commandTimeout := flag.Duration("command-timeout", meshcore.DefaultCommandTimeout, "How long a command waits for its response while the radio sends other frames; 0 for no limit")
+	contactsTimeout := flag.Duration("contacts-timeout", meshcore.DefaultContactsTimeout, "How long a whole contacts download may take; 0 for no limit")
+	readRetries := flag.Int("read-retries", meshcore.DefaultReadRetries, "Read timeouts tolerated while waiting for a command's response before it counts as a serial error")
+	retryBudget := flag.Int("retry-budget", 3, "Serial failures tolerated per scrape cycle before reconnecting")
+	extraLabels := flag.String("extra-labels", "", "Comma-separated key=value labels added to every metric (e.g. site=garage)")
+	flag.IntVar(&queueWarn, "queue-warn", 0, "Log a warning when a node's outbound queue length reaches this many packets; 0 disables")
+	flag.DurationVar(&rebootWait, "reboot-wait", rebootWait, "Time to wait after sending a reboot before reconnecting to the radio")
+	noReboot := flag.Bool("no-reboot-on-reconnect", false, "Reopen the serial port on errors without first rebooting the radio")
+	queueSample := flag.Duration("queue-sample-interval", 0, "In local push mode, also read the outbound queue length this often between collections, feeding meshcore_queue_length_histogram; 0 disables")
+	collectCore := flag.Bool("collect-core", true, "In local mode, request core stats (battery, uptime, queue) each interval")
+	collectRadio := flag.Bool("collect-radio", true, "In local mode, request radio stats (noise floor, RSSI, airtime) each interval")
+	dedupWindow := flag.Duration("mesh-dedup-window", meshcore.DefaultDedupWindow, "Count a mesh packet heard again within this long as a duplicate; 0 counts every copy")
+	meshTTL := flag.Duration("mesh-ttl", time.Hour, "Drop per-sender mesh series for senders not heard from in this long; 0 keeps them forever")
+	advertInterval := flag.Duration("advert-interval", 0, "In local mode, flood an advert for the companion radio this often (checked each -interval); 0 disables")
+	collectPackets := flag.Bool("collect-packets", true, "In local mode, request packet counters each interval")
+	controlSocket := flag.String("control-socket", defaultControlSocket, "Unix socket that get-region, set-region, reboot and advert use to reach the radio while the exporter holds its port; empty disables it")
+	appName := flag.String("app-name", meshcore.DefaultAppName, "Client name sent to the companion radio with AppStart, to tell exporters apart in its logs")
+	localAppStart := flag.Bool("local-app-start", false, "In local mode, run AppStart to label metrics with the radio's name and export its position and RF config")
+	enableMetrics := flag.String("enable-metrics", "", "Comma-separated metric names to export; all metrics when empty")
+	disableMetrics := flag.String("disable-metrics", "", "Comma-separated metric names to leave out of the exposition")
+	noNodeLabel := flag.Bool("no-node-label", false, "Drop the node label from the collected node's series on every /metrics endpoint")
+	initTimeout := flag.Duration("init-timeout", 0, "Overall time limit for remote init (AppStart, contacts and login); 0 for no limit")
+	contactsCache := flag.String("contacts-cache", "", "JSON file to persist contacts in for faster startup (remote mode only)")
+	logLevel := flag.String("log-level", "info", "Minimum log level: debug, info, warn or error")
+	logFormat := flag.String("log-format", "text", "Log output format: text or json")
 	flag.Parse()
+	rebootOnReconnect = !*noReboot
 
-	log.Printf("Opening serial port %s at %d baud", *port, *baud)
-	radio, err := meshcore.Open(*port, *baud)
+	logger, err := newLogger(*logLevel, *logFormat)
 	if err != nil {
-		log.Fatalf("Failed to open radio: %v", err)
+		log.Fatalf("Invalid logging flags: %v", err)
 	}
-	defer radio.Close()
+	slog.SetDefault(logger)
 
+	switch *output {
+	case "prometheus":
+	case "influx":
+		if *influxURL == "" {
+			fatal("-output influx requires -influx-url")
+		}
+		influx = &influxWriter{url: *influxURL, token: *influxToken, client: &http.Client{Timeout: 10 * time.Second}}
+	default:
+		fatal("Unknown -output (want prometheus or influx)", "output", *output)
+	}
+	if (*tlsCert == "") != (*tlsKey == "") {
+		fatal("-tls-cert and -tls-pem must be given together")
+	}
+	for _, f := range []string{*tlsCert, *tlsKey} {
+		if f == "" {
+			continue
+		}
+		if _, err := os.Stat(f); err != nil {
+			fatal("Cannot read TLS file", "err", err)
+		}
+	}
+	if err := validateRepeaters(*repeaters); err != nil {
+		fatal("Invalid -repeaters", "err", err)
+	}
+	labels, err := parseLabels(*extraLabels)
+	if err != nil {
+		fatal("Invalid -extra-labels", "err", err)
+	}
+	targets := parseRepeaters(*repeaters, passwords)
 	if *repeater != "" {
-		go collectRemoteMetrics(radio, *interval, *repeater, *password)
+		targets = append([]remoteTarget{{name: *repeater, passwords: passwords}}, targets...)
+	}
+
+	// In pull mode each scrape hands the local collector a channel to close
+	// once it has read the radio.
+	var scrapes chan chan struct{}
+	reg := prometheus.WrapRegistererWith(labels, prometheus.DefaultRegisterer)
+	switch *collectMode {
+	case "push":
+		err = metrics.Register(reg, splitList(*enableMetrics), splitList(*disableMetrics))
+	case "pull":
+		if len(targets) > 0 {
+			fatal("-collect-mode pull only supports local mode; remote requests take too long to answer a scrape")
+		}
+		if influx != nil {
+			fatal("-collect-mode pull needs Prometheus scrapes and can't be used with -output influx")
+		}
+		scrapes = make(chan chan struct{})
+		refresh := func() {
+			done := make(chan struct{})
+			timer := time.NewTimer(pullTimeout)
+			defer timer.Stop()
+			select {
+			case scrapes <- done:
+			case <-timer.C:
+				slog.Warn("Radio busy, serving the last values to this scrape", "timeout", pullTimeout)
+				return
+			}
+			select {
+			case <-done:
+			case <-timer.C:
+				slog.Warn("Radio read didn't finish in time, serving the last values to this scrape", "timeout", pullTimeout)
+			}
+		}
+		err = metrics.RegisterPull(reg, splitList(*enableMetrics), splitList(*disableMetrics), refresh, pullMaxAge)
+	default:
+		fatal("Unknown -collect-mode (want push or pull)", "collect_mode", *collectMode)
+	}
+	if err != nil {
+		fatal("Failed to register metrics", "err", err)
+	}
+
+	var radio *meshcore.Radio
+	if *replay != "" {
+		slog.Info("Replaying radio frames", "file", *replay)
+		radio, err = meshcore.OpenReplay(*replay)
 	} else {
-		go collectLocalMetrics(radio, *interval)
+		radio, err = openRadio(*transport, *port, *baud, *device)
+	}
+	if err != nil {
+		fatal("Failed to open radio", "err", err)
+	}
+	defer radio.Close()
+	radio.SetReadRetries(*readRetries)
+	radio.SetCommandTimeout(*commandTimeout)
+	radio.SetContactsTimeout(*contactsTimeout)
+	if len(*appName) > meshcore.MaxAppNameLen {
+		slog.Warn("-app-name is too long, truncating", "len", len(*appName), "max", meshcore.MaxAppNameLen)
+		*appName = (*appName)[:meshcore.MaxAppNameLen]
+	}
+	radio.SetAppName(*appName)
+	radio.SetDedupWindow(*dedupWindow)
+	if *capture != "" {
+		f, err := os.OpenFile(*capture, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			fatal("Failed to open capture file", "err", err)
+		}
+		defer f.Close()
+		slog.Info("Capturing received frames", "file", *capture)
+		radio.SetCapture(f)
+	}
+	if err := radio.SetReadTimeout(*readTimeout); err != nil {
+		fatal("Failed to set read timeout", "err", err)
+	}
+	metrics.SerialInfo.WithLabelValues(*port, strconv.Itoa(*baud)).Set(1)
+	metrics.BuildInfo.WithLabelValues(version, commit, runtime.Version()).Set(1)
+
+	if *meshTTL > 0 {
+		go pruneMeshSenders(radio, *meshTTL)
+	}
+	if *controlSocket != "" {
+		err := serveControl(*controlSocket, radio)
+		switch {
+		case err == nil:
+			defer os.Remove(*controlSocket)
+			slog.Info("Accepting control commands", "socket", *controlSocket)
+		case *controlSocket == defaultControlSocket && errors.Is(err, fs.ErrNotExist):
+			// Without a runtime directory, the default needs one made
+			// for the service; not having it isn't worth failing over.
+			slog.Warn("Control socket directory doesn't exist; control commands are off", "path", *controlSocket)
+		default:
+			fatal("Failed to listen on control socket", "path", *controlSocket, "err", err)
+		}
+	} else {
+		slog.Info("Control socket disabled")
 	}
 
-	log.Printf("Serving metrics on %s/metrics", *addr)
-	http.Handle("/metrics", promhttp.Handler())
-	log.Fatal(http.ListenAndServe(*addr, nil))
+	if len(targets) > 0 {
+		primaryNode.Store(targets[0].name)
+	} else {
+		primaryNode.Store("local")
+	}
+	health.interval = *interval
+	// In pull mode the radio is only read for scrapes, so sampling it in
+	// between would defeat the point.
+	if *queueSample > 0 && (len(targets) > 0 || scrapes != nil || *queueSample >= *interval) {
+		slog.Warn("-queue-sample-interval only applies in local push mode and when shorter than -interval; ignoring it",
+			"queue_sample_interval", *queueSample, "interval", *interval, "collect_mode", *collectMode)
+		*queueSample = 0
+	}
+	// On SIGINT or SIGTERM the HTTP server and remote collector are stopped
+	// so the radio and control socket are closed cleanly. The local
+	// collector's requests are short, so it isn't waited for.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	collectorDone := make(chan struct{})
+	if len(targets) > 0 {
+		go func() {
+			defer close(collectorDone)
+			collectRemoteMetrics(ctx, radio, *interval, remoteConfig{
+				targets:       targets,
+				loginDebounce: *loginDebounce,
+				initTimeout:   *initTimeout,
+				contactsCache: *contactsCache,
+			})
+		}()
+	} else {
+		close(collectorDone)
+		stats := localStats{core: *collectCore, radio: *collectRadio, packets: *collectPackets, queueSample: *queueSample}
+		go collectLocalMetrics(radio, *interval, *retryBudget, *localAppStart, stats, *advertInterval, scrapes)
+	}
+
+	if influx != nil {
+		slog.Info("Writing metrics to InfluxDB", "url", *influxURL)
+		<-ctx.Done()
+		slog.Info("Shutting down")
+		<-collectorDone
+		return
+	}
+
+	slog.Info("Serving metrics", "addr", *addr, "tls", *tlsCert != "")
+	// Everything but the health checks exposes collected data, so it all
+	// sits behind basic auth when credentials are configured.
+	protect := func(h http.Handler) http.Handler { return h }
+	if *metricsUser != "" || *metricsPass != "" {
+		protect = func(h http.Handler) http.Handler { return basicAuth(*metricsUser, *metricsPass, h) }
+	}
+	// -no-node-label applies to every exposition endpoint. Per-node paths
+	// select by the label before it is dropped.
+	flatten := func(g prometheus.Gatherer) prometheus.Gatherer { return g }
+	if *noNodeLabel {
+		flatten = func(g prometheus.Gatherer) prometheus.Gatherer {
+			return metrics.FlattenNode(g, func() string { return primaryNode.Load().(string) })
+		}
+	}
+	http.Handle("/metrics", protect(promhttp.HandlerFor(flatten(prometheus.DefaultGatherer), promhttp.HandlerOpts{})))
+	http.Handle("/snapshot", protect(snapshots))
+	http.HandleFunc("/healthz", health.healthz)
+	http.HandleFunc("/readyz", health.readyz)
+	changes := metrics.NewChanges(flatten(prometheus.DefaultGatherer))
+	http.Handle("/metrics/changed", protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		g := changes.Gatherer(r.URL.Query().Get("client"))
+		promhttp.HandlerFor(g, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+	})))
+	// /metrics/node/<node> always reaches the node, even one named
+	// "changed" or "node", which /metrics/<node> can't.
+	nodeMetrics := func(prefix string) http.Handler {
+		return protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			node := strings.TrimPrefix(r.URL.Path, prefix)
+			if node == "" {
+				http.NotFound(w, r)
+				return
+			}
+			g := flatten(metrics.NodeGatherer(prometheus.DefaultGatherer, node))
+			promhttp.HandlerFor(g, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+		}))
+	}
+	http.Handle("/metrics/node/", nodeMetrics("/metrics/node/"))
+	http.Handle("/metrics/", nodeMetrics("/metrics/"))
+	srv := &http.Server{Addr: *addr}
+	go func() {
+		var err error
+		if *tlsCert != "" {
+			err = srv.ListenAndServeTLS(*tlsCert, *tlsKey)
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if !errors.Is(err, http.ErrServerClosed) {
+			fatal("HTTP server stopped", "err", err)
+		}
+	}()
+
+	<-ctx.Done()
+	slog.Info("Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("HTTP server shutdown", "err", err)
+	}
+	<-collectorDone
+}
+
+// passwordList is a repeatable string flag.
+type passwordList []string
+
+func (p *passwordList) String() string { return strings.Repeat("*,", len(*p)) }
+
+func (p *passwordList) Set(v string) error {
+	*p = append(*p, v)
+	return nil
+}
+
+// primaryNode is the node label of the radio or repeater this process
+// collects from. Local mode updates it once the radio reports its own name.
+var primaryNode atomic.Value // string
+
+// splitList splits a comma-separated flag value, dropping empty entries.
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// parseRepeaters parses a -repeaters list of name or name:password entries.
+// Entries without a password use defaults.
+func parseRepeaters(s string, defaults []string) []remoteTarget {
+	var targets []remoteTarget
+	for _, entry := range splitList(s) {
+		name, password, ok := strings.Cut(entry, ":")
+		t := remoteTarget{name: name, passwords: defaults}
+		if ok {
+			t.passwords = []string{password}
+		}
+		targets = append(targets, t)
+	}
+	return targets
+}
+
+func validateRepeaters(s string) error {
+	seen := map[string]bool{}
+	for _, t := range parseRepeaters(s, nil) {
+		if t.name == "" {
+			return fmt.Errorf("empty repeater name in %q", s)
+		}
+		if seen[t.name] {
+			return fmt.Errorf("repeater %q listed twice", t.name)
+		}
+		seen[t.name] = true
+	}
+	return nil
+}
+
+// parseLabels parses a comma-separated list of key=value pairs.
+func parseLabels(s string) (prometheus.Labels, error) {
+	labels := prometheus.Labels{}
+	if s == "" {
+		return labels, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("expected key=value, got %q", pair)
+		}
+		labels[key] = value
+	}
+	return labels, nil
 }
 
 func setRegionCmd() {
 	fs := flag.NewFlagSet("set-region", flag.ExitOnError)
 	port := fs.String("port", "/dev/ttyACM0", "Serial port for MeshCore radio")
 	baud := fs.Int("baud", 115200, "Baud rate")
-	region := fs.String("region", "", "Region code (US, EU, AU, NZ)")
-	txPower := fs.Int("tx-power", 0, "TX power in dBm (optional, 1-22)")
+	region := fs.String("region", "", "Region code (US, EU, AU, NZ) for the region's default preset")
+	preset := fs.String("preset", "", "Named preset such as US-LongFast or EU-Narrow; overrides -region")
+	country := fs.String("country", "", "ISO country code to pick the region from (e.g. CA, DE); -region overrides it")
+	txPower := fs.Int("tx-power", 0, "TX power in dBm, up to the radio's maximum and the region's limit (default: the lower of the two)")
+	socket := fs.String("control-socket", defaultControlSocket, "Control socket of a running exporter to send the change through; the port is opened directly if none is listening")
 	fs.Parse(os.Args[2:])
 
-	if *region == "" {
-		fmt.Println("Available regions:")
-		for code, r := range meshcore.Regions {
-			fmt.Printf("  %s: %.3f MHz, %d kHz BW, SF%d, CR%d\n",
-				code, float64(r.FreqKHz)/1000.0, r.BwHz/1000, r.SF, r.CR)
+	if *preset != "" {
+		*region = *preset
+	}
+	if *region == "" && *country != "" {
+		r, ok := meshcore.RegionForCountry(*country)
+		if !ok {
+			fmt.Printf("No region preset for country %s; pass -region explicitly\n", *country)
+			os.Exit(1)
 		}
-		fmt.Println("\nUsage: meshcore-stats set-region -region US [-port /dev/ttyACM0]")
+		log.Printf("Country %s uses the %s region", strings.ToUpper(*country), r.Name)
+		*region = r.Name
+	}
+
+	if *region == "" {
+		printPresets()
+		fmt.Println("\nUsage: meshcore-stats set-region -region US|-preset US-LongFast|-country CA [-tx-power DBM] [-port /dev/ttyACM0]")
 		os.Exit(1)
 	}
 
-	r, ok := meshcore.Regions[strings.ToUpper(*region)]
+	r, ok := meshcore.LookupPreset(*region)
 	if !ok {
-		fmt.Printf("Unknown region: %s\n", *region)
-		fmt.Println("Available: US, EU, AU, NZ")
+		fmt.Printf("Unknown region or preset: %s\n\n", *region)
+		printPresets()
+		os.Exit(1)
+	}
+	if err := meshcore.ValidateRadioParams(r.FreqKHz, r.BwHz, r.SF, r.CR); err != nil {
+		fmt.Printf("Invalid preset %s: %v\n", r.FullName(), err)
+		os.Exit(1)
+	}
+
+	runOnRadio(*port, *baud, *socket, controlRequest{Command: "set-region", Preset: r.FullName(), TxPower: *txPower})
+}
+
+// setRegionOp applies region r and a TX power, 0 for the lower of the
+// radio's maximum and the region's limit, then checks what the radio applied.
+func setRegionOp(r meshcore.RadioRegion, txPower int) controlOp {
+	return func(radio *meshcore.Radio, l *log.Logger) error {
+		caps, err := radio.AppStart()
+		if err != nil {
+			return fmt.Errorf("failed to read radio capabilities: %w", err)
+		}
+		if txPower == 0 {
+			txPower = meshcore.DefaultTxPower(caps.MaxTx, r)
+			l.Printf("Defaulting TX power to %d dBm (radio maximum %d dBm, %s limit %d dBm EIRP)",
+				txPower, caps.MaxTx, r.Name, r.MaxTxPowerDBm)
+		}
+		if txPower > 0 {
+			if err := meshcore.ValidateTxPower(txPower, caps.MaxTx, r); err != nil {
+				return fmt.Errorf("invalid -tx-power: %w", err)
+			}
+		}
+
+		l.Printf("Setting region to %s (%.3f MHz, %d kHz BW, SF%d, CR%d)...",
+			r.FullName(), float64(r.FreqKHz)/1000.0, r.BwHz/1000, r.SF, r.CR)
+
+		if err := radio.SetRadioParams(r.FreqKHz, r.BwHz, r.SF, r.CR); err != nil {
+			return fmt.Errorf("failed to set radio params: %w", err)
+		}
+		l.Println("Radio parameters set successfully")
+
+		if txPower > 0 {
+			l.Printf("Setting TX power to %d dBm...", txPower)
+			if err := radio.SetRadioTxPower(uint8(txPower)); err != nil {
+				return fmt.Errorf("failed to set TX power: %w", err)
+			}
+			l.Println("TX power set successfully")
+		}
+
+		// The firmware acknowledges settings it has clamped or ignored, so read
+		// the applied configuration back and compare.
+		info, err := radio.AppStart()
+		if err != nil {
+			return fmt.Errorf("failed to read back radio configuration: %w", err)
+		}
+		drift := configDrift(r, uint8(txPower), info)
+		for _, d := range drift {
+			l.Printf("Drift: %s", d)
+		}
+		if len(drift) > 0 {
+			return errors.New("radio applied different settings than requested")
+		}
+
+		l.Println("Done! Radio is now configured for", r.Name)
+		return nil
+	}
+}
+
+func getRegionCmd() {
+	fs := flag.NewFlagSet("get-region", flag.ExitOnError)
+	port := fs.String("port", "/dev/ttyACM0", "Serial port for MeshCore radio")
+	baud := fs.Int("baud", 115200, "Baud rate")
+	socket := fs.String("control-socket", defaultControlSocket, "Control socket of a running exporter to read the radio through; the port is opened directly if none is listening")
+	fs.Parse(os.Args[2:])
+
+	runOnRadio(*port, *baud, *socket, controlRequest{Command: "get-region"})
+}
+
+// getRegionOp prints the radio's current parameters and the presets they
+// match, or that they're custom.
+func getRegionOp(radio *meshcore.Radio, l *log.Logger) error {
+	info, err := radio.AppStart()
+	if err != nil {
+		return fmt.Errorf("failed to read radio configuration: %w", err)
+	}
+	l.Printf("Radio is on %.3f MHz, %.1f kHz BW, SF%d, CR%d, TX power %d dBm",
+		float64(info.FreqKHz)/1000.0, float64(info.BwHz)/1000.0, info.SF, info.CR, info.TxPower)
+	matches := meshcore.MatchPresets(info.FreqKHz, info.BwHz, info.SF, info.CR)
+	if len(matches) == 0 {
+		l.Println("Preset: custom (matches no named preset)")
+		return nil
+	}
+	names := make([]string, len(matches))
+	for i, m := range matches {
+		names[i] = m.FullName()
+	}
+	l.Println("Preset:", strings.Join(names, ", "))
+	return nil
+}
+
+// printPresets lists the radio presets grouped by region, marking each
+// region's default and showing the TX power limit.
+func printPresets() {
+	fmt.Println("Available presets:")
+	codes := slices.Sorted(maps.Keys(meshcore.Presets))
+	for _, code := range codes {
+		fmt.Printf("  %s:\n", code)
+		for i, p := range meshcore.Presets[code] {
+			def := ""
+			if i == 0 {
+				def = " (default)"
+			}
+			fmt.Printf("    %-14s %.3f MHz, %.1f kHz BW, SF%d, CR%d, max %d dBm%s\n",
+				p.FullName(), float64(p.FreqKHz)/1000.0, float64(p.BwHz)/1000.0, p.SF, p.CR, p.MaxTxPowerDBm, def)
+		}
+	}
+}
+
+// configDrift compares the requested region and TX power (0 if not set)
+// against the configuration the radio reports, describing each mismatch.
+func configDrift(r meshcore.RadioRegion, txPower uint8, info *meshcore.SelfInfo) []string {
+	var drift []string
+	if info.FreqKHz != r.FreqKHz {
+		drift = append(drift, fmt.Sprintf("frequency is %d kHz, requested %d kHz", info.FreqKHz, r.FreqKHz))
+	}
+	if info.BwHz != r.BwHz {
+		drift = append(drift, fmt.Sprintf("bandwidth is %d Hz, requested %d Hz", info.BwHz, r.BwHz))
+	}
+	if info.SF != r.SF {
+		drift = append(drift, fmt.Sprintf("spreading factor is %d, requested %d", info.SF, r.SF))
+	}
+	if info.CR != r.CR {
+		drift = append(drift, fmt.Sprintf("coding rate is %d, requested %d", info.CR, r.CR))
+	}
+	if txPower > 0 && info.TxPower != txPower {
+		drift = append(drift, fmt.Sprintf("TX power is %d dBm, requested %d dBm (max %d)", info.TxPower, txPower, info.MaxTx))
+	}
+	return drift
+}
+
+func setAdvertIntervalCmd() {
+	fs := flag.NewFlagSet("set-advert-interval", flag.ExitOnError)
+	port := fs.String("port", "/dev/ttyACM0", "Serial port for MeshCore radio")
+	baud := fs.Int("baud", 115200, "Baud rate")
+	repeater := fs.String("repeater", "", "Repeater name, unique name prefix, or contact index")
+	password := fs.String("password", "", "Admin password for repeater login")
+	minutes := fs.Int("minutes", -1, fmt.Sprintf("Advert interval in minutes (0 to disable, %d-%d)",
+		meshcore.MinAdvertIntervalMins, meshcore.MaxAdvertIntervalMins))
+	fs.Parse(os.Args[2:])
+
+	if *repeater == "" || *minutes < 0 {
+		fmt.Println("Usage: meshcore-stats set-advert-interval -repeater NAME -password SECRET -minutes 120 [-port /dev/ttyACM0]")
+		os.Exit(1)
+	}
+	if err := meshcore.ValidateAdvertInterval(*minutes); err != nil {
+		fmt.Println(err)
 		os.Exit(1)
 	}
 
@@ -78,120 +625,717 @@ func setRegionCmd() {
 	}
 	defer radio.Close()
 
-	log.Printf("Setting region to %s (%.3f MHz, %d kHz BW, SF%d, CR%d)...",
-		r.Name, float64(r.FreqKHz)/1000.0, r.BwHz/1000, r.SF, r.CR)
+	contact, err := loginToRepeater(radio, *repeater, *password)
+	if err != nil {
+		log.Fatalf("Failed to log into repeater: %v", err)
+	}
+
+	log.Printf("Setting advert interval on %s to %d minutes...", contact.Name, *minutes)
+	if _, err := radio.SetAdvertInterval(contact.PubKey[:], uint16(*minutes)); err != nil {
+		log.Fatalf("Failed to send advert interval command: %v", err)
+	}
+	log.Println("Command sent. The repeater's reply is delivered as a direct message to this radio.")
+}
+
+// loginToRepeater initializes the companion radio, resolves the repeater
+// from its contacts, and waits for the login to be accepted.
+func loginToRepeater(radio *meshcore.Radio, name, password string) (*meshcore.Contact, error) {
+	if _, err := radio.AppStart(); err != nil {
+		return nil, fmt.Errorf("app start: %w", err)
+	}
+	contacts, err := radio.GetContacts()
+	if err != nil {
+		return nil, fmt.Errorf("get contacts: %w", err)
+	}
+	radio.SetContacts(contacts)
+	contact, err := meshcore.FindContact(contacts, name)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Logging into repeater %s (path=%d)...", contact.Name, contact.OutPathLen)
+	if _, err := radio.SendLogin(contact.PubKey[:], password); err != nil {
+		return nil, fmt.Errorf("send login: %w", err)
+	}
+	loginCodes := []byte{meshcore.PushCodeLoginSuccess, meshcore.PushCodeLoginFail}
+	data, err := radio.WaitForPushFrom(loginCodes, contact.PubKey[:], 30*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("waiting for login response: %w", err)
+	}
+	if data[0] != meshcore.PushCodeLoginSuccess {
+		reason, _ := meshcore.ParseLoginFail(data)
+		return nil, fmt.Errorf("login rejected by %s (reason %s; bad password?)", contact.Name, meshcore.LoginFailReasonName(reason))
+	}
+	return contact, nil
+}
+
+func advertCmd() {
+	fs := flag.NewFlagSet("advert", flag.ExitOnError)
+	port := fs.String("port", "/dev/ttyACM0", "Serial port for MeshCore radio")
+	baud := fs.Int("baud", 115200, "Baud rate")
+	zeroHop := fs.Bool("zero-hop", false, "Advertise to direct neighbours only instead of flooding the mesh")
+	socket := fs.String("control-socket", defaultControlSocket, "Control socket of a running exporter to send the advert through; the port is opened directly if none is listening")
+	fs.Parse(os.Args[2:])
+
+	runOnRadio(*port, *baud, *socket, controlRequest{Command: "advert", Flood: !*zeroHop})
+}
+
+func advertOp(flood bool) controlOp {
+	return func(radio *meshcore.Radio, l *log.Logger) error {
+		if err := radio.SendAdvert(flood); err != nil {
+			return fmt.Errorf("failed to send advert: %w", err)
+		}
+		l.Println("Advert sent")
+		return nil
+	}
+}
+
+func rebootCmd() {
+	fs := flag.NewFlagSet("reboot", flag.ExitOnError)
+	port := fs.String("port", "/dev/ttyACM0", "Serial port for MeshCore radio")
+	baud := fs.Int("baud", 115200, "Baud rate")
+	socket := fs.String("control-socket", defaultControlSocket, "Control socket of a running exporter to send the reboot through; the port is opened directly if none is listening")
+	fs.Parse(os.Args[2:])
+
+	runOnRadio(*port, *baud, *socket, controlRequest{Command: "reboot"})
+}
+
+// rebootOp restarts the radio. The firmware may restart before its reply
+// gets out, so a missing reply isn't treated as a failure.
+func rebootOp(radio *meshcore.Radio, l *log.Logger) error {
+	l.Println("Rebooting radio...")
+	if err := radio.Reboot(); err != nil && !errors.Is(err, meshcore.ErrReadTimeout) && !errors.Is(err, meshcore.ErrCommandTimeout) {
+		return fmt.Errorf("failed to reboot: %w", err)
+	}
+	l.Println("Reboot requested")
+	return nil
+}
+
+func sendTextCmd() {
+	fs := flag.NewFlagSet("send-text", flag.ExitOnError)
+	port := fs.String("port", "/dev/ttyACM0", "Serial port for MeshCore radio")
+	baud := fs.Int("baud", 115200, "Baud rate")
+	to := fs.String("to", "", "Contact name, unique name prefix, or contact index")
+	text := fs.String("text", "", fmt.Sprintf("Message text, up to %d bytes", meshcore.MaxTextMessageLen))
+	wait := fs.Duration("wait", 30*time.Second, "How long to wait for the delivery ack; 0 doesn't wait")
+	fs.Parse(os.Args[2:])
+
+	if *to == "" || *text == "" {
+		fmt.Println("Usage: meshcore-stats send-text -to NAME -text MESSAGE [-wait 30s] [-port /dev/ttyACM0]")
+		os.Exit(1)
+	}
+
+	log.Printf("Opening serial port %s at %d baud", *port, *baud)
+	radio, err := meshcore.Open(*port, *baud)
+	if err != nil {
+		log.Fatalf("Failed to open radio: %v", err)
+	}
+	defer radio.Close()
+
+	if _, err := radio.AppStart(); err != nil {
+		log.Fatalf("Failed to start app: %v", err)
+	}
+	contacts, err := radio.GetContacts()
+	if err != nil {
+		log.Fatalf("Failed to get contacts: %v", err)
+	}
+	contact, err := meshcore.FindContact(contacts, *to)
+	if err != nil {
+		log.Fatalf("Failed to find contact: %v", err)
+	}
+
+	tag, err := radio.SendText(contact.PubKey[:], *text)
+	if err != nil {
+		log.Fatalf("Failed to send message: %v", err)
+	}
+	log.Printf("Message sent to %s (tag %08X)", contact.Name, tag)
+	if *wait == 0 {
+		return
+	}
+	rtt, err := radio.WaitForDelivery(tag, *wait)
+	if err != nil {
+		log.Fatalf("Message not confirmed: %v", err)
+	}
+	log.Printf("Delivered in %s", rtt)
+}
+
+func contactsCmd() {
+	fs := flag.NewFlagSet("contacts", flag.ExitOnError)
+	port := fs.String("port", "/dev/ttyACM0", "Serial port for MeshCore radio")
+	baud := fs.Int("baud", 115200, "Baud rate")
+	fs.Parse(os.Args[2:])
+
+	log.Printf("Opening serial port %s at %d baud", *port, *baud)
+	radio, err := meshcore.Open(*port, *baud)
+	if err != nil {
+		log.Fatalf("Failed to open radio: %v", err)
+	}
+	defer radio.Close()
+
+	info, err := radio.AppStart()
+	if err != nil {
+		log.Fatalf("Failed to start app: %v", err)
+	}
+	log.Printf("Connected as: %s", info.Name)
+	contacts, err := radio.GetContacts()
+	if err != nil {
+		log.Fatalf("Failed to get contacts: %v", err)
+	}
+
+	// The index column is accepted by -repeater, as is any unique name prefix.
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "#\tNAME\tTYPE\tPUBKEY\tPATH\tLAT\tLON")
+	for i, c := range contacts {
+		path := strconv.Itoa(int(c.OutPathLen))
+		if c.OutPathLen < 0 {
+			path = "flood"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%X\t%s\t%.6f\t%.6f\n",
+			i+1, c.Name, meshcore.ContactTypeName(c.Type), c.PubKey[:6], path, c.Lat, c.Lon)
+	}
+	w.Flush()
+}
+
+func rawCmd() {
+	fs := flag.NewFlagSet("raw", flag.ExitOnError)
+	port := fs.String("port", "/dev/ttyACM0", "Serial port for MeshCore radio")
+	baud := fs.Int("baud", 115200, "Baud rate")
+	payload := fs.String("hex", "", "Command payload as hex, without frame header (e.g. 0A)")
+	confirm := fs.Bool("confirm", false, "Confirm sending an arbitrary command to the radio")
+	fs.Parse(os.Args[2:])
+
+	if *payload == "" {
+		fmt.Println("Usage: meshcore-stats raw -hex 0A -confirm [-port /dev/ttyACM0]")
+		os.Exit(1)
+	}
+	cmd, err := hex.DecodeString(strings.ReplaceAll(*payload, " ", ""))
+	if err != nil {
+		fmt.Printf("Invalid -hex payload: %v\n", err)
+		os.Exit(1)
+	}
+	if !*confirm {
+		fmt.Println("Raw commands can change or break radio configuration; pass -confirm to send.")
+		os.Exit(1)
+	}
+
+	log.Printf("Opening serial port %s at %d baud", *port, *baud)
+	radio, err := meshcore.Open(*port, *baud)
+	if err != nil {
+		log.Fatalf("Failed to open radio: %v", err)
+	}
+	defer radio.Close()
+
+	tx, rx, err := radio.SendRaw(cmd)
+	if tx != nil {
+		fmt.Printf("TX (%d bytes): % X\n", len(tx), tx)
+	}
+	if err != nil {
+		log.Fatalf("Raw command failed: %v", err)
+	}
+	fmt.Printf("RX (%d bytes): % X\n", len(rx), rx)
+}
+
+// pruneMeshSenders periodically drops the series of mesh senders that have
+// not been heard from within ttl. Checks run at least a second apart, since
+// a tiny ttl would otherwise make the interval zero and stop the ticker.
+func pruneMeshSenders(radio *meshcore.Radio, ttl time.Duration) {
+	every := max(min(ttl/4, time.Minute), time.Second)
+	for range time.Tick(every) {
+		if n := radio.PruneSenders(ttl); n > 0 {
+			slog.Info("Pruned quiet mesh senders", "senders", n, "ttl", ttl)
+		}
+	}
+}
+
+// openRadio connects to the radio over the named transport. For tcp, port is
+// the host:port of a serial-to-network bridge and baud is unused.
+func openRadio(transport, port string, baud int, device string) (*meshcore.Radio, error) {
+	switch transport {
+	case "serial":
+		slog.Info("Opening serial port", "port", port, "baud", baud)
+		return meshcore.Open(port, baud)
+	case "tcp":
+		slog.Info("Connecting to radio over TCP", "addr", port)
+		return meshcore.OpenTCP(port)
+	case "ble":
+		if device == "" {
+			return nil, fmt.Errorf("-transport ble requires -device")
+		}
+		slog.Info("Connecting to radio over BLE", "device", device)
+		return meshcore.OpenBLE(device)
+	default:
+		return nil, fmt.Errorf("unknown transport %q (want serial, tcp or ble)", transport)
+	}
+}
+
+func isSerialError(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "input/output error") ||
+		strings.Contains(msg, "no such device") ||
+		strings.Contains(msg, "broken pipe") ||
+		strings.Contains(msg, "device not configured") ||
+		strings.Contains(msg, "connection reset") ||
+		strings.Contains(msg, "EOF") ||
+		strings.Contains(msg, "invalid frame header")
+}
+
+// rebootWait is how long reconnect waits after the reboot command before the
+// first attempt to reopen the port. Set from -reboot-wait.
+var rebootWait = 5 * time.Second
+
+// rebootOnReconnect controls whether reconnect reboots the radio before
+// reopening the port. Cleared by -no-reboot-on-reconnect for boards that a
+// reboot wedges until power cycled.
+var rebootOnReconnect = true
+
+// reconnect reboots and reopens the radio. downSince is when the serial
+// failure was first observed and is used to report the outage duration.
+func reconnect(radio *meshcore.Radio, node string, downSince time.Time) bool {
+	metrics.ScrapeErrors.WithLabelValues(node).Inc()
+
+	if rebootOnReconnect {
+		slog.Warn("Serial connection error, attempting reboot and reconnect", "node", node)
+		metrics.RadioReboots.WithLabelValues(node).Inc()
+		if err := radio.Reboot(); err != nil {
+			slog.Warn("Reboot command failed (expected if port is dead)", "node", node, "err", err)
+		} else {
+			slog.Info("Reboot command sent, waiting for radio to restart", "node", node, "wait", rebootWait)
+		}
+		time.Sleep(rebootWait)
+	} else {
+		slog.Warn("Serial connection error, attempting reconnect", "node", node)
+	}
+
+	for attempt := 1; ; attempt++ {
+		if err := radio.Reconnect(); err != nil {
+			delay := time.Duration(attempt) * 5 * time.Second
+			if delay > 60*time.Second {
+				delay = 60 * time.Second
+			}
+			slog.Error("Reconnect attempt failed", "node", node, "attempt", attempt, "err", err, "retry_in", delay)
+			time.Sleep(delay)
+			continue
+		}
+		outage := time.Since(downSince)
+		slog.Warn("Reconnected to radio", "node", node, "attempts", attempt, "outage", outage.Round(time.Second))
+		metrics.SerialReconnects.WithLabelValues(node).Inc()
+		metrics.SerialDowntime.WithLabelValues(node).Set(outage.Seconds())
+		metrics.SerialOutageDuration.WithLabelValues(node).Observe(outage.Seconds())
+		return true
+	}
+}
+
+// retryBudget bounds the number of serial failures a single collection cycle
+// may absorb, so a dead radio escalates to a reconnect after a fixed number of
+// timeouts no matter how many commands the cycle issues.
+type retryBudget struct {
+	remaining    int
+	firstFailure time.Time
+}
+
+// retry calls fn until it succeeds, fails with a non-serial error, or the
+// shared budget is exhausted, in which case the last error is returned.
+func retry[T any](b *retryBudget, node string, fn func() (T, error)) (T, error) {
+	for {
+		v, err := fn()
+		if err == nil || !isSerialError(err) {
+			return v, err
+		}
+		if b.firstFailure.IsZero() {
+			b.firstFailure = time.Now()
+		}
+		b.remaining--
+		if b.remaining <= 0 {
+			return v, err
+		}
+		slog.Warn("Serial error, retrying", "node", node, "err", err, "retries_left", b.remaining)
+		metrics.ScrapeErrors.WithLabelValues(node).Inc()
+	}
+}
+
+// maxPacketDelta is the largest per-scrape change in a packet counter that is
+// treated as a real reading. A single flipped byte in a stats frame moves a
+// counter by at least 2^24, far beyond any real traffic between scrapes.
+const maxPacketDelta = 1 << 20
+
+// lastPackets holds the last published packet stats per node. It is only
+// touched from the collector goroutine.
+var lastPackets = map[string]*meshcore.StatsPackets{}
+
+// plausibleCounter reports whether a counter moving from prev to cur is a
+// believable reading: a bounded increase, or a reset back to near zero.
+func plausibleCounter(prev, cur uint32) bool {
+	if cur >= prev {
+		return cur-prev <= maxPacketDelta
+	}
+	return cur <= maxPacketDelta
+}
+
+// plausiblePackets checks every counter in p against the previous reading.
+func plausiblePackets(prev, p *meshcore.StatsPackets) bool {
+	return plausibleCounter(prev.Recv, p.Recv) &&
+		plausibleCounter(prev.Sent, p.Sent) &&
+		plausibleCounter(prev.FloodTx, p.FloodTx) &&
+		plausibleCounter(prev.DirectTx, p.DirectTx) &&
+		plausibleCounter(prev.FloodRx, p.FloodRx) &&
+		plausibleCounter(prev.DirectRx, p.DirectRx)
+}
+
+// counterDelta returns how far a firmware counter advanced from prev to cur.
+// A lower value means the radio rebooted and counted cur since.
+func counterDelta(prev, cur uint32) float64 {
+	if cur >= prev {
+		return float64(cur - prev)
+	}
+	return float64(cur)
+}
+
+// countPackets advances the PacketsCounted counters for node by the change
+// from prev to p. The first reading only creates the series, so restarting
+// the exporter doesn't count the radio's whole history again.
+func countPackets(node string, prev, p *meshcore.StatsPackets) {
+	if prev == nil {
+		prev = p
+	}
+	for _, c := range []struct {
+		name      string
+		prev, cur uint32
+	}{
+		{"received", prev.Recv, p.Recv},
+		{"sent", prev.Sent, p.Sent},
+		{"flood_tx", prev.FloodTx, p.FloodTx},
+		{"direct_tx", prev.DirectTx, p.DirectTx},
+		{"flood_rx", prev.FloodRx, p.FloodRx},
+		{"direct_rx", prev.DirectRx, p.DirectRx},
+	} {
+		metrics.PacketsCounted.WithLabelValues(node, c.name).Add(counterDelta(c.prev, c.cur))
+	}
+}
+
+// publishPackets sets the packet counters for node along with the derived
+// flood/direct ratios. Readings with an implausible jump from the previous
+// scrape are logged and dropped rather than published.
+func publishPackets(node string, p *meshcore.StatsPackets) {
+	prev, ok := lastPackets[node]
+	if ok && !plausiblePackets(prev, p) {
+		slog.Warn("Ignoring implausible packet stats", "node", node,
+			"rx_prev", prev.Recv, "rx", p.Recv, "tx_prev", prev.Sent, "tx", p.Sent)
+		metrics.ImplausibleReadings.WithLabelValues(node).Inc()
+		return
+	}
+	countPackets(node, prev, p)
+	lastPackets[node] = p
+	metrics.PacketStatsUpdated.WithLabelValues(node).SetToCurrentTime()
+	metrics.PacketsReceived.WithLabelValues(node).Set(float64(p.Recv))
+	metrics.PacketsSent.WithLabelValues(node).Set(float64(p.Sent))
+	metrics.PacketsFloodTx.WithLabelValues(node).Set(float64(p.FloodTx))
+	metrics.PacketsDirectTx.WithLabelValues(node).Set(float64(p.DirectTx))
+	metrics.PacketsFloodRx.WithLabelValues(node).Set(float64(p.FloodRx))
+	metrics.PacketsDirectRx.WithLabelValues(node).Set(float64(p.DirectRx))
+	if ratio, ok := floodRatio(p.FloodTx, p.DirectTx); ok {
+		metrics.FloodRatioTx.WithLabelValues(node).Set(ratio)
+	}
+	if ratio, ok := floodRatio(p.FloodRx, p.DirectRx); ok {
+		metrics.FloodRatioRx.WithLabelValues(node).Set(ratio)
+	}
+}
+
+// floodRatio returns the fraction of packets that were flood routed. ok is
+// false when no packets have been routed either way.
+func floodRatio(flood, direct uint32) (ratio float64, ok bool) {
+	total := float64(flood) + float64(direct)
+	if total == 0 {
+		return 0, false
+	}
+	return float64(flood) / total, true
+}
+
+// queueWarn is the outbound queue length at which publishQueueLength logs a
+// congestion warning. Set from -queue-warn; 0 disables the warning.
+var queueWarn int
+
+// publishQueueLength sets the queue length gauge for node and adds the
+// sample to its histogram. The firmware
+// doesn't report its queue capacity, so saturation is flagged against the
+// operator-supplied queueWarn threshold.
+func publishQueueLength(node string, queueLen uint8) {
+	metrics.QueueLength.WithLabelValues(node).Set(float64(queueLen))
+	metrics.QueueLengthHistogram.WithLabelValues(node).Observe(float64(queueLen))
+	if queueWarn > 0 && int(queueLen) >= queueWarn {
+		slog.Warn("Outbound queue at threshold; the radio may be congested", "node", node, "queue_len", queueLen, "threshold", queueWarn)
+	}
+}
+
+// telemetryGauges maps the LPP types exported per channel to their gauges.
+var telemetryGauges = map[uint8]*metrics.GaugeVec{
+	meshcore.LPPVoltage:     metrics.TelemetryVoltage,
+	meshcore.LPPTemperature: metrics.TelemetryTemperature,
+	meshcore.LPPHumidity:    metrics.TelemetryHumidity,
+	meshcore.LPPBarometer:   metrics.TelemetryPressure,
+	meshcore.LPPCurrent:     metrics.TelemetryCurrent,
+}
+
+// publishTelemetry sets a per-channel gauge for each telemetry reading the
+// exporter understands.
+func publishTelemetry(node string, t *meshcore.TelemetryData) {
+	for _, r := range t.Channels {
+		if g, ok := telemetryGauges[r.Type]; ok {
+			g.WithLabelValues(node, strconv.Itoa(int(r.Channel))).Set(r.Value)
+		}
+	}
+	metrics.TelemetryUpdated.WithLabelValues(node).SetToCurrentTime()
+}
+
+const (
+	batterySourceCoreStats = "core_stats"
+	batterySourceCommand   = "battery_command"
+)
 
-	if err := radio.SetRadioParams(r.FreqKHz, r.BwHz, r.SF, r.CR); err != nil {
-		log.Fatalf("Failed to set radio params: %v", err)
+// publishLocalBattery sets the battery gauge from core stats, falling back to
+// the dedicated battery command on boards whose core stats report 0 mV. A
+// zero reading is never published so dashboards don't show a dead battery.
+func publishLocalBattery(radio *meshcore.Radio, node string, coreMV uint16) {
+	mv, source := coreMV, batterySourceCoreStats
+	if mv == 0 {
+		fallback, err := radio.GetBatteryMillivolts()
+		if err != nil {
+			slog.Warn("Core stats battery is 0 and battery command failed", "node", node, "err", err)
+			return
+		}
+		mv, source = fallback, batterySourceCommand
 	}
-	log.Println("Radio parameters set successfully")
-
-	if *txPower > 0 {
-		log.Printf("Setting TX power to %d dBm...", *txPower)
-		if err := radio.SetRadioTxPower(uint8(*txPower)); err != nil {
-			log.Fatalf("Failed to set TX power: %v", err)
+	if mv == 0 {
+		return
+	}
+	metrics.BatteryMillivolts.WithLabelValues(node).Set(float64(mv))
+	for _, s := range []string{batterySourceCoreStats, batterySourceCommand} {
+		v := 0.0
+		if s == source {
+			v = 1
 		}
-		log.Println("TX power set successfully")
+		metrics.BatterySource.WithLabelValues(node, s).Set(v)
 	}
-
-	log.Println("Done! Radio is now configured for", r.Name)
 }
 
-func isSerialError(err error) bool {
-	if err == nil {
-		return false
+// publishFirmwareVersion asks the radio for its firmware version and exports
+// it for node.
+func publishFirmwareVersion(radio *meshcore.Radio, node string) {
+	v, err := radio.GetVersion()
+	if err != nil {
+		slog.Warn("Getting firmware version failed", "node", node, "err", err)
+		return
 	}
-	msg := err.Error()
-	return strings.Contains(msg, "input/output error") ||
-		strings.Contains(msg, "no such device") ||
-		strings.Contains(msg, "broken pipe") ||
-		strings.Contains(msg, "device not configured") ||
-		strings.Contains(msg, "invalid frame header")
+	slog.Info("Radio firmware", "node", node, "version", v)
+	metrics.FirmwareInfo.Reset()
+	metrics.FirmwareInfo.WithLabelValues(node, v).Set(1)
 }
 
-func reconnect(radio *meshcore.Radio, node string) bool {
-	log.Printf("Serial connection error, attempting reboot and reconnect...")
-	metrics.ScrapeErrors.WithLabelValues(node).Inc()
-
-	metrics.RadioReboots.WithLabelValues(node).Inc()
-	if err := radio.Reboot(); err != nil {
-		log.Printf("Reboot command failed (expected if port is dead): %v", err)
-	} else {
-		log.Printf("Reboot command sent, waiting for radio to restart...")
+// publishSelfInfo exports the companion radio's RF configuration and position
+// as reported by AppStart.
+func publishSelfInfo(info *meshcore.SelfInfo) {
+	if info.BwHz != 0 {
+		slog.Info("Radio configuration", "node", info.Name,
+			"freq_mhz", float64(info.FreqKHz)/1000.0, "bw_khz", float64(info.BwHz)/1000.0, "sf", info.SF, "cr", info.CR)
+		metrics.LoRaSymbolTime.WithLabelValues(info.Name).Set(meshcore.SymbolTime(info.BwHz, info.SF))
+		metrics.LoRaBitrate.WithLabelValues(info.Name).Set(meshcore.DataRate(info.BwHz, info.SF, info.CR))
+		metrics.RadioFreqKHz.WithLabelValues(info.Name).Set(float64(info.FreqKHz))
+		metrics.RadioBandwidthHz.WithLabelValues(info.Name).Set(float64(info.BwHz))
+		metrics.RadioSpreadingFactor.WithLabelValues(info.Name).Set(float64(info.SF))
+		metrics.RadioCodingRate.WithLabelValues(info.Name).Set(float64(info.CR))
+	}
+	metrics.TxPowerDBm.WithLabelValues(info.Name).Set(float64(info.TxPower))
+	if info.MaxTx != 0 {
+		metrics.MaxTxPowerDBm.WithLabelValues(info.Name).Set(float64(info.MaxTx))
 	}
-	time.Sleep(5 * time.Second)
+	if info.Lat != 0 || info.Lon != 0 {
+		metrics.NodeLatitude.WithLabelValues(info.Name).Set(info.Lat)
+		metrics.NodeLongitude.WithLabelValues(info.Name).Set(info.Lon)
+	}
+}
 
-	for attempt := 1; ; attempt++ {
-		if err := radio.Reconnect(); err != nil {
-			delay := time.Duration(attempt) * 5 * time.Second
-			if delay > 60*time.Second {
-				delay = 60 * time.Second
-			}
-			log.Printf("Reconnect attempt %d failed: %v (retrying in %s)", attempt, err, delay)
-			time.Sleep(delay)
+// localStats selects which stats types collectLocalMetrics requests, so a
+// battery-powered radio isn't woken for counters nobody reads.
+type localStats struct {
+	core, radio, packets bool
+	// queueSample, if nonzero, is how often the queue length is also read
+	// between collections.
+	queueSample time.Duration
+}
+
+// sampleQueueLength reads node's core stats every interval and adds the
+// queue length to its histogram, catching bursts the per-collection gauge
+// misses. Failures are left to the regular collection to report, and a
+// sample is skipped while a collection pass or control command has the radio.
+func sampleQueueLength(radio *meshcore.Radio, node string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if !radioOps.TryLock() {
 			continue
 		}
-		log.Printf("Reconnected to serial port after %d attempt(s)", attempt)
-		metrics.SerialReconnects.WithLabelValues(node).Inc()
-		return true
+		core, err := radio.GetStatsCore()
+		radioOps.Unlock()
+		if err != nil {
+			slog.Debug("Error sampling queue length", "node", node, "err", err)
+			continue
+		}
+		metrics.QueueLengthHistogram.WithLabelValues(node).Observe(float64(core.QueueLen))
 	}
 }
 
-func collectLocalMetrics(radio *meshcore.Radio, interval time.Duration) {
-	const node = "local"
+// pullMaxAge is how long values read for one scrape in -collect-mode pull
+// are reused for the next.
+const pullMaxAge = 5 * time.Second
+
+// pullTimeout bounds how long a scrape in -collect-mode pull waits for the
+// radio, so a wedged or reconnecting radio doesn't hang the scrape past
+// Prometheus' default 10s scrape timeout. Scrapes that give up get whatever
+// values the last read left behind.
+const pullTimeout = 8 * time.Second
+
+// collectLocalMetrics reads the companion radio's own stats every interval,
+// or, when scrapes is non-nil, once per request received on it, closing the
+// request's channel when done.
+func collectLocalMetrics(radio *meshcore.Radio, interval time.Duration, retries int, appStart bool, stats localStats, advertInterval time.Duration, scrapes <-chan chan struct{}) {
+	node := "local"
+	if appStart {
+		if info, err := radio.AppStart(); err != nil {
+			slog.Warn("AppStart failed, using default node label", "node", node, "err", err)
+		} else if info.Name != "" {
+			slog.Info("Connected", "node", info.Name, "lat", info.Lat, "lon", info.Lon)
+			node = info.Name
+			primaryNode.Store(node)
+			publishSelfInfo(info)
+		}
+	}
+	radio.SetNodeName(node)
 	metrics.RadioReboots.WithLabelValues(node)
 	metrics.SerialReconnects.WithLabelValues(node)
+	metrics.Up.WithLabelValues(node).Set(0)
+	metrics.AdvertsSent.WithLabelValues(node)
+	publishFirmwareVersion(radio, node)
+	if !stats.core && !stats.radio && !stats.packets {
+		slog.Warn("-collect-core, -collect-radio and -collect-packets are all disabled; no stats will be requested from the radio")
+		for done := range scrapes {
+			close(done)
+		}
+		return
+	}
+	if stats.core && stats.queueSample > 0 {
+		go sampleQueueLength(radio, node, stats.queueSample)
+	}
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
+	var lastAdvert time.Time
 
 	collect := func() (reconnected bool) {
-		if core, err := radio.GetStatsCore(); err != nil {
-			log.Printf("Error getting core stats: %v", err)
-			metrics.ScrapeErrors.WithLabelValues(node).Inc()
-			if isSerialError(err) {
-				reconnect(radio, node)
-				return true
+		radioOps.Lock()
+		defer radioOps.Unlock()
+		budget := &retryBudget{remaining: retries}
+		var sample struct {
+			core    *meshcore.StatsCore
+			radio   *meshcore.StatsRadio
+			packets *meshcore.StatsPackets
+		}
+		defer func() { writeInflux(node, sample.core, sample.radio, sample.packets) }()
+		if advertInterval > 0 && time.Since(lastAdvert) >= advertInterval {
+			if err := radio.SendAdvert(true); err != nil {
+				slog.Error("Error sending advert", "node", node, "err", err)
+			} else {
+				slog.Info("Sent flood advert", "node", node)
+			}
+			lastAdvert = time.Now()
+		}
+		up := 1.0
+		defer func() {
+			metrics.Up.WithLabelValues(node).Set(up)
+			if up == 1 {
+				health.succeeded()
+			}
+		}()
+		if stats.core {
+			if core, err := retry(budget, node, radio.GetStatsCore); err != nil {
+				slog.Error("Error getting core stats", "node", node, "err", err)
+				metrics.ScrapeErrors.WithLabelValues(node).Inc()
+				up = 0
+				if isSerialError(err) {
+					metrics.Up.WithLabelValues(node).Set(0)
+					reconnect(radio, node, budget.firstFailure)
+					return true
+				}
+			} else {
+				publishLocalBattery(radio, node, core.BatteryMV)
+				metrics.UptimeSeconds.WithLabelValues(node).Set(float64(core.UptimeSecs))
+				metrics.ErrorFlags.WithLabelValues(node).Set(float64(core.Errors))
+				for flag, set := range meshcore.DecodeErrorFlags(core.Errors) {
+					v := 0.0
+					if set {
+						v = 1
+					}
+					metrics.ErrorFlag.WithLabelValues(node, flag).Set(v)
+				}
+				publishQueueLength(node, core.QueueLen)
+				if core.HasTemp {
+					metrics.TemperatureCelsius.WithLabelValues(node).Set(core.TemperatureC)
+				}
+				metrics.CoreStatsUpdated.WithLabelValues(node).SetToCurrentTime()
+				snapshots.setCore(node, core)
+				sample.core = core
 			}
-		} else {
-			metrics.BatteryMillivolts.WithLabelValues(node).Set(float64(core.BatteryMV))
-			metrics.UptimeSeconds.WithLabelValues(node).Set(float64(core.UptimeSecs))
-			metrics.ErrorFlags.WithLabelValues(node).Set(float64(core.Errors))
-			metrics.QueueLength.WithLabelValues(node).Set(float64(core.QueueLen))
 		}
 
-		if radioStats, err := radio.GetStatsRadio(); err != nil {
-			log.Printf("Error getting radio stats: %v", err)
-			metrics.ScrapeErrors.WithLabelValues(node).Inc()
-			if isSerialError(err) {
-				reconnect(radio, node)
-				return true
+		if stats.radio {
+			if radioStats, err := retry(budget, node, radio.GetStatsRadio); err != nil {
+				slog.Error("Error getting radio stats", "node", node, "err", err)
+				metrics.ScrapeErrors.WithLabelValues(node).Inc()
+				up = 0
+				if isSerialError(err) {
+					metrics.Up.WithLabelValues(node).Set(0)
+					reconnect(radio, node, budget.firstFailure)
+					return true
+				}
+			} else {
+				metrics.NoiseFloorDBm.WithLabelValues(node).Set(float64(radioStats.NoiseFloor))
+				metrics.LastRSSI.WithLabelValues(node).Set(float64(radioStats.LastRSSI))
+				metrics.LastSNR.WithLabelValues(node).Set(radioStats.LastSNR)
+				metrics.TxAirtimeSeconds.WithLabelValues(node).Set(float64(radioStats.TxAirSecs))
+				metrics.RxAirtimeSeconds.WithLabelValues(node).Set(float64(radioStats.RxAirSecs))
+				metrics.RadioStatsUpdated.WithLabelValues(node).SetToCurrentTime()
+				snapshots.setRadio(node, radioStats)
+				sample.radio = radioStats
 			}
-		} else {
-			metrics.NoiseFloorDBm.WithLabelValues(node).Set(float64(radioStats.NoiseFloor))
-			metrics.LastRSSI.WithLabelValues(node).Set(float64(radioStats.LastRSSI))
-			metrics.LastSNR.WithLabelValues(node).Set(radioStats.LastSNR)
-			metrics.TxAirtimeSeconds.WithLabelValues(node).Set(float64(radioStats.TxAirSecs))
-			metrics.RxAirtimeSeconds.WithLabelValues(node).Set(float64(radioStats.RxAirSecs))
 		}
 
-		if packets, err := radio.GetStatsPackets(); err != nil {
-			log.Printf("Error getting packet stats: %v", err)
-			metrics.ScrapeErrors.WithLabelValues(node).Inc()
-			if isSerialError(err) {
-				reconnect(radio, node)
-				return true
+		if stats.packets {
+			if packets, err := retry(budget, node, radio.GetStatsPackets); err != nil {
+				slog.Error("Error getting packet stats", "node", node, "err", err)
+				metrics.ScrapeErrors.WithLabelValues(node).Inc()
+				up = 0
+				if isSerialError(err) {
+					metrics.Up.WithLabelValues(node).Set(0)
+					reconnect(radio, node, budget.firstFailure)
+					return true
+				}
+			} else {
+				publishPackets(node, packets)
+				snapshots.setPackets(node, packets)
+				sample.packets = packets
 			}
-		} else {
-			metrics.PacketsReceived.WithLabelValues(node).Set(float64(packets.Recv))
-			metrics.PacketsSent.WithLabelValues(node).Set(float64(packets.Sent))
-			metrics.PacketsFloodTx.WithLabelValues(node).Set(float64(packets.FloodTx))
-			metrics.PacketsDirectTx.WithLabelValues(node).Set(float64(packets.DirectTx))
-			metrics.PacketsFloodRx.WithLabelValues(node).Set(float64(packets.FloodRx))
-			metrics.PacketsDirectRx.WithLabelValues(node).Set(float64(packets.DirectRx))
 		}
 		return false
 	}
 
+	if scrapes != nil {
+		for done := range scrapes {
+			for collect() {
+			}
+			close(done)
+		}
+		return
+	}
 	for collect() {
 	}
 	for range ticker.C {
@@ -200,219 +1344,639 @@ func collectLocalMetrics(radio *meshcore.Radio, interval time.Duration) {
 	}
 }
 
-func collectRemoteMetrics(radio *meshcore.Radio, interval time.Duration, repeaterName, password string) {
-	metrics.RadioReboots.WithLabelValues(repeaterName)
-	metrics.SerialReconnects.WithLabelValues(repeaterName)
-	metrics.RepeaterLogins.WithLabelValues(repeaterName)
+// debouncedGauge publishes a new value only after it has been observed
+// threshold times in a row, so a single failed request doesn't flap a state
+// gauge between 1 and 0.
+type debouncedGauge struct {
+	gauge     prometheus.Gauge
+	threshold int
+	published bool
+	value     float64
+	pending   float64
+	streak    int
+}
+
+func (d *debouncedGauge) observe(v float64) {
+	if d.published && v == d.value {
+		d.streak = 0
+		return
+	}
+	if v != d.pending {
+		d.pending = v
+		d.streak = 0
+	}
+	d.streak++
+	if !d.published || d.streak >= d.threshold {
+		d.gauge.Set(v)
+		d.value = v
+		d.published = true
+		d.streak = 0
+	}
+}
+
+// remoteTarget is a repeater to collect from over the mesh.
+type remoteTarget struct {
+	// name is the repeater as given on the command line: a name, unique
+	// prefix or contact index.
+	name string
+	// passwords are tried in order until the repeater accepts one. The one
+	// that worked is tried first on later logins.
+	passwords []string
+}
+
+// remoteConfig holds the command-line settings for collecting from
+// repeaters over the mesh.
+type remoteConfig struct {
+	targets       []remoteTarget
+	loginDebounce int
+	// initTimeout, if nonzero, bounds the init sequence from AppStart
+	// through login; init is abandoned and retried next cycle past it.
+	initTimeout time.Duration
+	// contactsCache, if set, is a JSON file the last fetched contacts are
+	// saved to and loaded from at startup.
+	contactsCache string
+}
+
+// repeaterState is the session state for one repeater, kept separately so a
+// failed login or query on one doesn't reset the others.
+type repeaterState struct {
+	remoteTarget
+	// node is the repeater's node label: its contact name once resolved,
+	// so the label doesn't depend on how it was given or on contact order.
+	node          string
+	contact       *meshcore.Contact
+	loggedIn      bool
+	passwordIndex int
+	loginStatus   *debouncedGauge
+	// ownerInfoAt is when owner info was last read; it is re-read on the
+	// contact refresh schedule.
+	ownerInfoAt time.Time
+}
+
+// setContact records the contact rep resolved to, moving its node label to
+// the contact's name.
+func (r *repeaterState) setContact(c *meshcore.Contact, loginDebounce int) {
+	r.contact = c
+	if c.Name != "" && c.Name != r.node {
+		r.node = c.Name
+		r.loginStatus = nil
+	}
+	if r.loginStatus != nil {
+		return
+	}
+	metrics.RepeaterLogins.WithLabelValues(r.node)
+	r.loginStatus = &debouncedGauge{gauge: metrics.LoginStatus.WithLabelValues(r.node), threshold: loginDebounce}
+}
+
+func (r *repeaterState) reset() {
+	r.contact = nil
+	r.loggedIn = false
+	r.ownerInfoAt = time.Time{}
+}
+
+// collectRemoteMetrics polls each configured repeater in turn every
+// interval until ctx is cancelled. Radio-wide metrics such as reconnects are
+// labeled with the first repeater.
+func collectRemoteMetrics(ctx context.Context, radio *meshcore.Radio, interval time.Duration, cfg remoteConfig) {
+	// Until the first repeater is found in the contacts, radio-wide metrics
+	// are labeled with the name it was given as.
+	primary := cfg.targets[0].name
+	radio.SetNodeName(primary)
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
-	var targetContact *meshcore.Contact
-	var loggedIn bool
+	reps := make([]*repeaterState, len(cfg.targets))
+	for i, t := range cfg.targets {
+		reps[i] = &repeaterState{remoteTarget: t, node: t.name}
+	}
+
+	var initialized bool
+	var contacts []meshcore.Contact
 	var lastContactRefresh time.Time
 	const contactRefreshInterval = 1 * time.Hour
+	var selfName string
+	var selfLat, selfLon float64
+	var selfKey [meshcore.PubKeySize]byte
+	var selfKnown bool
+	var contactsCapacity int
+	const contactsWarnRatio = 0.9
+
+	// Contacts loaded from the cache let the first cycle skip the slow
+	// contact download. They are used until a fetch from the radio confirms
+	// them, which happens right after the first cycle.
+	var cachedContacts []meshcore.Contact
+	var contactsFromCache bool
+	if cfg.contactsCache != "" {
+		cached, err := meshcore.LoadContacts(cfg.contactsCache)
+		switch {
+		case err == nil:
+			slog.Info("Loaded contacts cache", "contacts", len(cached), "file", cfg.contactsCache)
+			cachedContacts = cached
+		case os.IsNotExist(err):
+			slog.Info("No contacts cache yet", "file", cfg.contactsCache)
+		default:
+			slog.Warn("Ignoring contacts cache", "err", err)
+		}
+	}
 
 	resetState := func() {
-		targetContact = nil
-		loggedIn = false
+		initialized = false
+		for _, rep := range reps {
+			rep.reset()
+		}
+	}
+
+	// initCtx bounds the whole init sequence (AppStart through login) when
+	// -init-timeout is set, cutting short the contact download and login
+	// waits it covers. Outside of init it is just ctx.
+	initCtx, endInit := ctx, context.CancelFunc(func() {})
+	stopInit := func() {
+		endInit()
+		initCtx, endInit = ctx, func() {}
+	}
+	startInit := func() {
+		stopInit()
+		if cfg.initTimeout > 0 {
+			initCtx, endInit = context.WithTimeout(ctx, cfg.initTimeout)
+		}
+	}
+	initTimedOut := func(step string) bool {
+		if !errors.Is(initCtx.Err(), context.DeadlineExceeded) {
+			return false
+		}
+		slog.Warn("Remote init timed out, retrying next cycle", "timeout", cfg.initTimeout, "step", step)
+		metrics.ScrapeErrors.WithLabelValues(primary).Inc()
+		stopInit()
+		resetState()
+		return true
 	}
 
 	handleIOError := func(err error) bool {
 		if !isSerialError(err) {
 			return false
 		}
-		reconnect(radio, repeaterName)
+		reconnect(radio, primary, time.Now())
 		resetState()
 		return true
 	}
 
-	refreshContacts := func() bool {
-		log.Printf("Refreshing contacts...")
-		contacts, err := radio.GetContacts()
-		if err != nil {
-			log.Printf("Error refreshing contacts: %v", err)
-			return handleIOError(err)
+	recordContactUsage := func(used int) {
+		metrics.ContactsUsed.WithLabelValues(selfName).Set(float64(used))
+		if contactsCapacity == 0 {
+			return
 		}
-		radio.SetContacts(contacts)
-		log.Printf("Contacts refreshed (%d nodes)", len(contacts))
-		for i := range contacts {
-			c := &contacts[i]
+		metrics.ContactsCapacity.WithLabelValues(selfName).Set(float64(contactsCapacity))
+		if float64(used) >= contactsWarnRatio*float64(contactsCapacity) {
+			slog.Warn("Contact table nearly full; the radio may stop learning new nodes", "node", selfName, "used", used, "capacity", contactsCapacity)
+		}
+	}
+
+	applyContacts := func(list []meshcore.Contact) {
+		contacts = list
+		radio.SetContacts(list)
+		recordContactUsage(len(list))
+		// Reset so contacts dropped from the table don't linger.
+		metrics.ContactPathLength.Reset()
+		metrics.ContactsByType.Reset()
+		metrics.ContactDistanceKm.Reset()
+		selfPlaced := selfLat != 0 || selfLon != 0
+		byType := make(map[string]int)
+		for i := range list {
+			c := &list[i]
+			byType[meshcore.ContactTypeName(c.Type)]++
+			metrics.ContactPathLength.WithLabelValues(selfName, c.Name).Set(float64(c.OutPathLen))
 			if c.Lat != 0 || c.Lon != 0 {
 				metrics.NodeLatitude.WithLabelValues(c.Name).Set(c.Lat)
 				metrics.NodeLongitude.WithLabelValues(c.Name).Set(c.Lon)
+				if selfPlaced {
+					d := meshcore.DistanceKm(selfLat, selfLon, c.Lat, c.Lon)
+					metrics.ContactDistanceKm.WithLabelValues(selfName, c.Name).Set(d)
+				}
 			}
 		}
+		for t, n := range byType {
+			metrics.ContactsByType.WithLabelValues(selfName, t).Set(float64(n))
+		}
+	}
+
+	saveContacts := func(list []meshcore.Contact) {
+		if cfg.contactsCache == "" {
+			return
+		}
+		if err := meshcore.SaveContacts(cfg.contactsCache, list); err != nil {
+			slog.Error("Error saving contacts cache", "err", err)
+		}
+	}
+
+	// setContact resolves rep to c and, for the first repeater, moves the
+	// radio-wide labels along with it.
+	setContact := func(rep *repeaterState, c *meshcore.Contact) {
+		rep.setContact(c, cfg.loginDebounce)
+		if rep != reps[0] || rep.node == primary {
+			return
+		}
+		primary = rep.node
+		radio.SetNodeName(primary)
+		primaryNode.Store(primary)
+		metrics.RadioReboots.WithLabelValues(primary)
+		metrics.SerialReconnects.WithLabelValues(primary)
+	}
+
+	resolve := func(rep *repeaterState) bool {
+		c, err := meshcore.FindContact(contacts, rep.name)
+		if err != nil {
+			slog.Error("Repeater not found in contacts", "repeater", rep.name, "err", err)
+			for _, c := range contacts {
+				slog.Info("Available contact", "name", c.Name, "type", meshcore.ContactTypeName(c.Type))
+			}
+			return false
+		}
+		setContact(rep, c)
+		slog.Info("Found repeater", "repeater", rep.name, "node", rep.node, "type", meshcore.ContactTypeName(c.Type), "lat", c.Lat, "lon", c.Lon)
+		return true
+	}
+
+	refreshContacts := func() bool {
+		slog.Debug("Refreshing contacts")
+		fresh, err := radio.GetContacts()
+		if err != nil {
+			slog.Error("Error refreshing contacts", "err", err)
+			return handleIOError(err)
+		}
+		applyContacts(fresh)
+		saveContacts(fresh)
+		slog.Info("Contacts refreshed", "contacts", len(fresh))
 		lastContactRefresh = time.Now()
+
+		verify := contactsFromCache
+		contactsFromCache = false
+		for _, rep := range reps {
+			if rep.contact == nil {
+				resolve(rep)
+				continue
+			}
+			if !verify {
+				continue
+			}
+			c, err := meshcore.FindContact(fresh, rep.name)
+			switch {
+			case err != nil:
+				slog.Warn("Cached repeater is no longer in contacts", "repeater", rep.name, "node", rep.node, "err", err)
+				rep.reset()
+			case c.PubKey != rep.contact.PubKey:
+				slog.Warn("Repeater resolved to a different key than the cache, logging in again", "repeater", rep.name, "name", c.Name)
+				setContact(rep, c)
+				rep.loggedIn = false
+			default:
+				setContact(rep, c)
+			}
+		}
 		return false
 	}
 
-	collect := func() (reconnected bool) {
-		if targetContact != nil && time.Since(lastContactRefresh) > contactRefreshInterval {
-			if refreshContacts() {
+	// checkIdentity records the companion radio's key from selfInfo and
+	// reports whether it differs from the one seen before, meaning the
+	// radio was replaced or reflashed.
+	checkIdentity := func(selfInfo *meshcore.SelfInfo) (changed bool) {
+		changed = selfKnown && selfInfo.PubKey != selfKey
+		if changed {
+			slog.Warn("Companion radio identity changed; the radio was replaced or reflashed",
+				"old_key", fmt.Sprintf("%X", selfKey[:6]), "old_name", selfName,
+				"new_key", fmt.Sprintf("%X", selfInfo.PubKey[:6]), "new_name", selfInfo.Name)
+			metrics.IdentityChanges.WithLabelValues(selfInfo.Name).Inc()
+		}
+		selfKey, selfKnown = selfInfo.PubKey, true
+		selfName = selfInfo.Name
+		return changed
+	}
+
+	initCompanion := func() (reconnected bool) {
+		slog.Info("Initializing companion radio")
+		startInit()
+		selfInfo, err := radio.AppStart()
+		if err != nil {
+			slog.Error("Error starting app", "err", err)
+			metrics.ScrapeErrors.WithLabelValues(primary).Inc()
+			return handleIOError(err)
+		}
+		slog.Info("Connected", "node", selfInfo.Name, "lat", selfInfo.Lat, "lon", selfInfo.Lon)
+		radio.AddSelfToContacts(selfInfo)
+		checkIdentity(selfInfo)
+		selfLat, selfLon = selfInfo.Lat, selfInfo.Lon
+		publishSelfInfo(selfInfo)
+		publishFirmwareVersion(radio, selfInfo.Name)
+		if info, err := radio.DeviceQuery(); err != nil {
+			slog.Warn("Device query failed (contact capacity unknown)", "err", err)
+			if handleIOError(err) {
 				return true
 			}
+		} else {
+			contactsCapacity = info.MaxContacts
+		}
+		if initTimedOut("device query") {
+			return false
 		}
 
-		if targetContact == nil {
-			log.Printf("Initializing companion radio...")
-			selfInfo, err := radio.AppStart()
-			if err != nil {
-				log.Printf("Error starting app: %v", err)
-				metrics.ScrapeErrors.WithLabelValues(repeaterName).Inc()
-				return handleIOError(err)
-			}
-			log.Printf("Connected as: %s (%.6f, %.6f)", selfInfo.Name, selfInfo.Lat, selfInfo.Lon)
-			radio.AddSelfToContacts(selfInfo)
-			if selfInfo.Lat != 0 || selfInfo.Lon != 0 {
-				metrics.NodeLatitude.WithLabelValues(selfInfo.Name).Set(selfInfo.Lat)
-				metrics.NodeLongitude.WithLabelValues(selfInfo.Name).Set(selfInfo.Lon)
+		var list []meshcore.Contact
+		if cachedContacts != nil {
+			slog.Info("Using cached contacts until they can be refreshed from the radio")
+			list, cachedContacts = cachedContacts, nil
+			contactsFromCache = true
+		} else {
+			slog.Debug("Getting contacts")
+			list, err = radio.GetContactsContext(initCtx)
+			if initTimedOut("contact download") {
+				return false
 			}
-
-			log.Printf("Getting contacts...")
-			contacts, err := radio.GetContacts()
 			if err != nil {
-				log.Printf("Error getting contacts: %v", err)
-				metrics.ScrapeErrors.WithLabelValues(repeaterName).Inc()
+				slog.Error("Error getting contacts", "err", err)
+				metrics.ScrapeErrors.WithLabelValues(primary).Inc()
 				return handleIOError(err)
 			}
-
-			radio.SetContacts(contacts)
+			saveContacts(list)
 			lastContactRefresh = time.Now()
-			log.Printf("Contacts (%d):", len(contacts))
-			for i := range contacts {
-				c := &contacts[i]
-				log.Printf("  [%02X] %s (type=%d, path=%d)", c.PubKey[0], c.Name, c.Type, c.OutPathLen)
-				if c.Lat != 0 || c.Lon != 0 {
-					metrics.NodeLatitude.WithLabelValues(c.Name).Set(c.Lat)
-					metrics.NodeLongitude.WithLabelValues(c.Name).Set(c.Lon)
-				}
-				if strings.EqualFold(c.Name, repeaterName) {
-					targetContact = c
-					log.Printf("Found repeater: %s (type=%d) at (%.6f, %.6f)", c.Name, c.Type, c.Lat, c.Lon)
-				}
-			}
+			contactsFromCache = false
+		}
 
-			if targetContact == nil {
-				log.Printf("Repeater '%s' not found in contacts. Available:", repeaterName)
-				for _, c := range contacts {
-					log.Printf("  - %s (type=%d)", c.Name, c.Type)
-				}
-				return false
-			}
+		applyContacts(list)
+		slog.Info("Contacts loaded", "contacts", len(list))
+		for i := range list {
+			c := &list[i]
+			slog.Debug("Contact", "index", i+1, "hash", fmt.Sprintf("%02X", c.PubKey[0]), "name", c.Name,
+				"type", meshcore.ContactTypeName(c.Type), "path_len", c.OutPathLen)
+		}
+		initialized = true
+		for _, rep := range reps {
+			resolve(rep)
 		}
+		return false
+	}
 
-		if !loggedIn && password != "" {
-			log.Printf("Logging into repeater %s (path=%d)...", targetContact.Name, targetContact.OutPathLen)
-			radio.SetNodeName(repeaterName)
-			_, err := radio.SendLogin(targetContact.PubKey[:], password)
+	login := func(rep *repeaterState) (reconnected, ok bool) {
+		slog.Debug("Logging into repeater", "node", rep.node, "path_len", rep.contact.OutPathLen)
+		for attempt := 0; attempt < len(rep.passwords); attempt++ {
+			if initTimedOut("login") {
+				return false, false
+			}
+			idx := (rep.passwordIndex + attempt) % len(rep.passwords)
+			_, err := radio.SendLogin(rep.contact.PubKey[:], rep.passwords[idx])
 			if err != nil {
-				log.Printf("Error sending login: %v", err)
-				metrics.ScrapeErrors.WithLabelValues(repeaterName).Inc()
-				metrics.LoginStatus.WithLabelValues(repeaterName).Set(0)
-				return handleIOError(err)
+				slog.Error("Error sending login", "node", rep.node, "err", err)
+				metrics.ScrapeErrors.WithLabelValues(rep.node).Inc()
+				rep.loginStatus.observe(0)
+				return handleIOError(err), false
 			}
 
 			loginCodes := []byte{meshcore.PushCodeLoginSuccess, meshcore.PushCodeLoginFail}
-			data, err := radio.WaitForPushCode(loginCodes, 30*time.Second)
+			data, err := radio.WaitForPushFromContext(initCtx, loginCodes, rep.contact.PubKey[:], 30*time.Second)
+			if initTimedOut("login") {
+				return false, false
+			}
 			if err != nil {
-				log.Printf("Error waiting for login response (repeater unreachable?): %v", err)
-				metrics.ScrapeErrors.WithLabelValues(repeaterName).Inc()
-				metrics.LoginStatus.WithLabelValues(repeaterName).Set(0)
+				slog.Warn("No login response (repeater unreachable?)", "node", rep.node, "err", err)
+				metrics.ScrapeErrors.WithLabelValues(rep.node).Inc()
+				rep.loginStatus.observe(0)
 				if handleIOError(err) {
-					return true
+					return true, false
 				}
-				log.Printf("Attempting status request without confirmed login...")
-			} else if data[0] == meshcore.PushCodeLoginSuccess {
-				log.Printf("Login successful!")
-				loggedIn = true
-				metrics.LoginStatus.WithLabelValues(repeaterName).Set(1)
-				metrics.RepeaterLogins.WithLabelValues(repeaterName).Inc()
-			} else {
-				log.Printf("Login failed (bad password?)")
-				metrics.LoginStatus.WithLabelValues(repeaterName).Set(0)
-				return false
+				slog.Info("Attempting status request without confirmed login", "node", rep.node)
+				return false, true
+			}
+			if data[0] == meshcore.PushCodeLoginSuccess {
+				slog.Info("Login successful", "node", rep.node, "password", idx+1, "passwords", len(rep.passwords))
+				rep.loggedIn = true
+				rep.passwordIndex = idx
+				rep.loginStatus.observe(1)
+				metrics.RepeaterLogins.WithLabelValues(rep.node).Inc()
+				metrics.LoginPasswordIndex.WithLabelValues(rep.node).Set(float64(idx))
+				return false, true
+			}
+			reason := "unknown"
+			if code, err := meshcore.ParseLoginFail(data); err == nil {
+				reason = meshcore.LoginFailReasonName(code)
+			}
+			metrics.LoginFailures.WithLabelValues(rep.node, reason).Inc()
+			slog.Warn("Login rejected", "node", rep.node, "password", idx+1, "passwords", len(rep.passwords), "reason", reason)
+		}
+		slog.Error("Login failed (bad password?)", "node", rep.node)
+		rep.loginStatus.observe(0)
+		return false, false
+	}
+
+	fetchOwnerInfo := func(rep *repeaterState) {
+		slog.Debug("Requesting owner info", "node", rep.node)
+		tag, err := radio.SendOwnerInfoReq(rep.contact.PubKey[:])
+		if err != nil {
+			slog.Error("Error sending owner info request", "node", rep.node, "err", err)
+			return
+		}
+		data, err := radio.WaitForReplyContext(ctx, []byte{meshcore.PushCodeBinaryResponse}, rep.contact.PubKey[:], tag, 10*time.Second)
+		if err != nil {
+			slog.Warn("Owner info not available", "node", rep.node, "err", err)
+			radio.DrainPort()
+			return
+		}
+		version, name, owner, err := meshcore.ParseOwnerInfoResponse(data)
+		if err != nil {
+			slog.Error("Error parsing owner info response", "node", rep.node, "err", err)
+			return
+		}
+		slog.Info("Owner info", "node", rep.node, "version", version, "name", name, "owner", owner)
+		metrics.RepeaterInfo.DeletePartialMatch(prometheus.Labels{"node": rep.node})
+		metrics.RepeaterInfo.WithLabelValues(rep.node, version, name, owner).Set(1)
+		rep.ownerInfoAt = time.Now()
+	}
+
+	queryRepeater := func(rep *repeaterState) (reconnected bool) {
+		node := rep.node
+		if !rep.loggedIn && len(rep.passwords) > 0 {
+			if reconnected, ok := login(rep); !ok {
+				return reconnected
 			}
 		}
 
-		log.Printf("Requesting status from %s (path=%d)...", targetContact.Name, targetContact.OutPathLen)
-		_, err := radio.SendStatusReq(targetContact.PubKey[:])
+		slog.Debug("Requesting status", "node", node, "path_len", rep.contact.OutPathLen)
+		statusSentAt := time.Now()
+		_, err := radio.SendStatusReq(rep.contact.PubKey[:])
 		if err != nil {
-			log.Printf("Error sending status request: %v", err)
-			metrics.ScrapeErrors.WithLabelValues(repeaterName).Inc()
-			loggedIn = false
+			slog.Error("Error sending status request", "node", node, "err", err)
+			metrics.ScrapeErrors.WithLabelValues(node).Inc()
+			rep.loggedIn = false
 			return handleIOError(err)
 		}
 
 		statusCodes := []byte{meshcore.PushCodeStatusResponse}
-		data, err := radio.WaitForPushCode(statusCodes, 30*time.Second)
+		data, err := radio.WaitForPushFromContext(ctx, statusCodes, rep.contact.PubKey[:], 30*time.Second)
 		if err != nil {
-			log.Printf("Error waiting for status response: %v", err)
-			metrics.ScrapeErrors.WithLabelValues(repeaterName).Inc()
-			loggedIn = false
+			slog.Error("Error waiting for status response", "node", node, "err", err)
+			metrics.ScrapeErrors.WithLabelValues(node).Inc()
+			rep.loggedIn = false
 			return handleIOError(err)
 		}
 
 		if data[0] == meshcore.PushCodeStatusResponse {
 			core, radioStats, packets, err := meshcore.ParseStatusResponse(data)
 			if err != nil {
-				log.Printf("Error parsing status response: %v", err)
-				metrics.ScrapeErrors.WithLabelValues(repeaterName).Inc()
+				slog.Error("Error parsing status response", "node", node, "err", err)
+				metrics.ScrapeErrors.WithLabelValues(node).Inc()
+				metrics.ParseErrors.WithLabelValues(node, "status").Inc()
 				return false
 			}
+			if rep.loggedIn {
+				rep.loginStatus.observe(1)
+			}
+			health.succeeded()
+
+			if core.BatteryMV != 0 {
+				metrics.BatteryMillivolts.WithLabelValues(node).Set(float64(core.BatteryMV))
+			}
+			metrics.UptimeSeconds.WithLabelValues(node).Set(float64(core.UptimeSecs))
+			metrics.ErrorFlags.WithLabelValues(node).Set(float64(core.Errors))
+			for flag, set := range meshcore.DecodeErrorFlags(core.Errors) {
+				v := 0.0
+				if set {
+					v = 1
+				}
+				metrics.ErrorFlag.WithLabelValues(node, flag).Set(v)
+			}
+			publishQueueLength(node, core.QueueLen)
 
-			metrics.BatteryMillivolts.WithLabelValues(repeaterName).Set(float64(core.BatteryMV))
-			metrics.UptimeSeconds.WithLabelValues(repeaterName).Set(float64(core.UptimeSecs))
-			metrics.QueueLength.WithLabelValues(repeaterName).Set(float64(core.QueueLen))
+			metrics.NoiseFloorDBm.WithLabelValues(node).Set(float64(radioStats.NoiseFloor))
+			metrics.LastRSSI.WithLabelValues(node).Set(float64(radioStats.LastRSSI))
+			metrics.LastSNR.WithLabelValues(node).Set(radioStats.LastSNR)
+			metrics.TxAirtimeSeconds.WithLabelValues(node).Set(float64(radioStats.TxAirSecs))
+			if radioStats.RxAirSecs != 0 {
+				metrics.RxAirtimeSeconds.WithLabelValues(node).Set(float64(radioStats.RxAirSecs))
+			}
+			metrics.CoreStatsUpdated.WithLabelValues(node).SetToCurrentTime()
+			metrics.RadioStatsUpdated.WithLabelValues(node).SetToCurrentTime()
 
-			metrics.LastRSSI.WithLabelValues(repeaterName).Set(float64(radioStats.LastRSSI))
-			metrics.LastSNR.WithLabelValues(repeaterName).Set(radioStats.LastSNR)
-			metrics.TxAirtimeSeconds.WithLabelValues(repeaterName).Set(float64(radioStats.TxAirSecs))
+			publishPackets(node, packets)
+			writeInflux(node, core, radioStats, packets)
 
-			metrics.PacketsReceived.WithLabelValues(repeaterName).Set(float64(packets.Recv))
-			metrics.PacketsSent.WithLabelValues(repeaterName).Set(float64(packets.Sent))
-			metrics.PacketsFloodTx.WithLabelValues(repeaterName).Set(float64(packets.FloodTx))
-			metrics.PacketsDirectTx.WithLabelValues(repeaterName).Set(float64(packets.DirectTx))
-			metrics.PacketsFloodRx.WithLabelValues(repeaterName).Set(float64(packets.FloodRx))
-			metrics.PacketsDirectRx.WithLabelValues(repeaterName).Set(float64(packets.DirectRx))
+			// The companion logs each packet it receives just before handling
+			// it, so the last rx log since the request is the status response:
+			// the reverse direction of the link the repeater's stats describe.
+			if rssi, snr, at := radio.LastRxSignal(); at.After(statusSentAt) {
+				metrics.RemoteLinkRxRSSI.WithLabelValues(node).Set(float64(rssi))
+				metrics.RemoteLinkRxSNR.WithLabelValues(node).Set(snr)
+			}
 
-			log.Printf("Stats: battery=%dmV, rssi=%d, snr=%.1f, rx=%d (flood=%d, direct=%d), tx=%d (flood=%d, direct=%d)",
-				core.BatteryMV, radioStats.LastRSSI, radioStats.LastSNR,
-				packets.Recv, packets.FloodRx, packets.DirectRx,
-				packets.Sent, packets.FloodTx, packets.DirectTx)
+			slog.Debug("Stats", "node", node, "battery_mv", core.BatteryMV,
+				"rssi", radioStats.LastRSSI, "snr", radioStats.LastSNR,
+				"rx", packets.Recv, "flood_rx", packets.FloodRx, "direct_rx", packets.DirectRx,
+				"tx", packets.Sent, "flood_tx", packets.FloodTx, "direct_tx", packets.DirectTx)
 
-			log.Printf("Requesting telemetry from %s (path=%d)...", targetContact.Name, targetContact.OutPathLen)
-			_, err = radio.SendTelemetryReq(targetContact.PubKey[:])
+			slog.Debug("Requesting telemetry", "node", node, "path_len", rep.contact.OutPathLen)
+			tag, err := radio.SendTelemetryReq(rep.contact.PubKey[:])
 			if err != nil {
-				log.Printf("Error sending telemetry request: %v", err)
+				slog.Error("Error sending telemetry request", "node", node, "err", err)
 			} else {
-				telemetryCodes := []byte{meshcore.PushCodeBinaryResponse}
-				tdata, err := radio.WaitForPushCode(telemetryCodes, 10*time.Second)
+				telemetryCodes := []byte{meshcore.PushCodeBinaryResponse, meshcore.PushCodeTelemetryResponse}
+				tdata, err := radio.WaitForReplyContext(ctx, telemetryCodes, rep.contact.PubKey[:], tag, 10*time.Second)
 				if err != nil {
-					log.Printf("Telemetry not available (repeater may not support it): %v", err)
+					slog.Warn("Telemetry not available (repeater may not support it)", "node", node, "err", err)
 					radio.DrainPort()
 				} else {
-					log.Printf("Telemetry response: %d bytes, data=%X", len(tdata), tdata)
+					slog.Debug("Telemetry response", "node", node, "bytes", len(tdata), "data", fmt.Sprintf("%X", tdata))
 					telemetry, err := meshcore.ParseTelemetryResponse(tdata)
 					if err != nil {
-						log.Printf("Error parsing telemetry response: %v", err)
-					} else if telemetry.HasTemp {
-						metrics.TemperatureCelsius.WithLabelValues(repeaterName).Set(telemetry.Temperature)
-						log.Printf("Telemetry: battery=%.2fV, temperature=%.1f°C", telemetry.BatteryVolts, telemetry.Temperature)
+						slog.Error("Error parsing telemetry response", "node", node, "err", err)
 					} else {
-						log.Printf("Telemetry: battery=%.2fV, no temperature data", telemetry.BatteryVolts)
+						publishTelemetry(node, telemetry)
+						if telemetry.HasTemp {
+							metrics.TemperatureCelsius.WithLabelValues(node).Set(telemetry.Temperature)
+							slog.Debug("Telemetry", "node", node, "battery_v", telemetry.BatteryVolts, "temperature_c", telemetry.Temperature, "channels", len(telemetry.Channels))
+						} else {
+							slog.Debug("Telemetry", "node", node, "battery_v", telemetry.BatteryVolts, "channels", len(telemetry.Channels))
+						}
 					}
 				}
 			}
+
+			if time.Since(rep.ownerInfoAt) > contactRefreshInterval {
+				fetchOwnerInfo(rep)
+			}
 		} else {
-			log.Printf("Unexpected response: 0x%02X", data[0])
+			slog.Warn("Unexpected response", "node", node, "code", fmt.Sprintf("0x%02X", data[0]))
 		}
 		return false
 	}
 
-	for collect() {
+	queryRepeaters := func() (reconnected bool) {
+		defer stopInit()
+		// The identity is checked every pass, not just on reconnect, since
+		// a radio swapped behind a TCP bridge needn't drop the connection.
+		if initialized {
+			selfInfo, err := radio.AppStart()
+			if err != nil {
+				slog.Error("Error checking companion radio identity", "err", err)
+				metrics.ScrapeErrors.WithLabelValues(primary).Inc()
+				return handleIOError(err)
+			}
+			if checkIdentity(selfInfo) {
+				// The new radio has its own contacts and repeater sessions.
+				resetState()
+			}
+		}
+		if initialized {
+			unresolved := slices.ContainsFunc(reps, func(r *repeaterState) bool { return r.contact == nil })
+			if unresolved || time.Since(lastContactRefresh) > contactRefreshInterval {
+				if refreshContacts() {
+					return true
+				}
+			}
+		} else {
+			if initCompanion() {
+				return true
+			}
+			if !initialized {
+				return false
+			}
+		}
+
+		for _, rep := range reps {
+			if ctx.Err() != nil {
+				return false
+			}
+			if rep.contact == nil {
+				continue
+			}
+			if queryRepeater(rep) {
+				return true
+			}
+			if !initialized {
+				// -init-timeout expired during a login.
+				return false
+			}
+		}
+		return false
 	}
-	for range ticker.C {
-		for collect() {
+
+	collect := func() (reconnected bool) {
+		radioOps.Lock()
+		defer radioOps.Unlock()
+		if queryRepeaters() {
+			return true
+		}
+		if contactsFromCache {
+			return refreshContacts()
+		}
+		return false
+	}
+
+	// A wait cut short by shutdown fails like any other, so ctx is checked
+	// before retrying.
+	for collect() && ctx.Err() == nil {
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("Remote collector stopped")
+			return
+		case <-ticker.C:
+			for collect() && ctx.Err() == nil {
+			}
 		}
 	}
 }
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/watsoncj/meshcore-stats/internal/meshcore"
+)
+
+// statsCache holds the latest stats read in local mode for /snapshot, for
+// consumers that don't run Prometheus.
+type statsCache struct {
+	mu   sync.Mutex
+	snap statsSnapshot
+}
+
+type statsSnapshot struct {
+	Node      string           `json:"node"`
+	UpdatedAt *time.Time       `json:"updated_at"` // last successful read of any stats type
+	Core      *coreSnapshot    `json:"core,omitempty"`
+	Radio     *radioSnapshot   `json:"radio,omitempty"`
+	Packets   *packetsSnapshot `json:"packets,omitempty"`
+}
+
+type coreSnapshot struct {
+	BatteryMV    uint16   `json:"battery_mv"`
+	UptimeSecs   uint32   `json:"uptime_secs"`
+	ErrorFlags   uint16   `json:"error_flags"`
+	QueueLen     uint8    `json:"queue_len"`
+	TemperatureC *float64 `json:"temperature_c,omitempty"`
+}
+
+type radioSnapshot struct {
+	NoiseFloor int16   `json:"noise_floor_dbm"`
+	LastRSSI   int8    `json:"last_rssi_dbm"`
+	LastSNR    float64 `json:"last_snr_db"`
+	TxAirSecs  uint32  `json:"tx_air_secs"`
+	RxAirSecs  uint32  `json:"rx_air_secs"`
+}
+
+type packetsSnapshot struct {
+	Recv     uint32 `json:"recv"`
+	Sent     uint32 `json:"sent"`
+	FloodTx  uint32 `json:"flood_tx"`
+	DirectTx uint32 `json:"direct_tx"`
+	FloodRx  uint32 `json:"flood_rx"`
+	DirectRx uint32 `json:"direct_rx"`
+}
+
+var snapshots = &statsCache{}
+
+// update applies fn to the snapshot for node and stamps it with the current
+// time.
+func (c *statsCache) update(node string, fn func(*statsSnapshot)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	c.snap.Node = node
+	c.snap.UpdatedAt = &now
+	fn(&c.snap)
+}
+
+func (c *statsCache) setCore(node string, s *meshcore.StatsCore) {
+	core := &coreSnapshot{
+		BatteryMV:  s.BatteryMV,
+		UptimeSecs: s.UptimeSecs,
+		ErrorFlags: s.Errors,
+		QueueLen:   s.QueueLen,
+	}
+	if s.HasTemp {
+		t := s.TemperatureC
+		core.TemperatureC = &t
+	}
+	c.update(node, func(snap *statsSnapshot) { snap.Core = core })
+}
+
+func (c *statsCache) setRadio(node string, s *meshcore.StatsRadio) {
+	radio := &radioSnapshot{
+		NoiseFloor: s.NoiseFloor,
+		LastRSSI:   s.LastRSSI,
+		LastSNR:    s.LastSNR,
+		TxAirSecs:  s.TxAirSecs,
+		RxAirSecs:  s.RxAirSecs,
+	}
+	c.update(node, func(snap *statsSnapshot) { snap.Radio = radio })
+}
+
+func (c *statsCache) setPackets(node string, s *meshcore.StatsPackets) {
+	packets := &packetsSnapshot{
+		Recv:     s.Recv,
+		Sent:     s.Sent,
+		FloodTx:  s.FloodTx,
+		DirectTx: s.DirectTx,
+		FloodRx:  s.FloodRx,
+		DirectRx: s.DirectRx,
+	}
+	c.update(node, func(snap *statsSnapshot) { snap.Packets = packets })
+}
+
+func (c *statsCache) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	body, err := json.Marshal(c.snap)
+	c.mu.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
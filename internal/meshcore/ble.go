@@ -0,0 +1,146 @@
+package meshcore
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"tinygo.org/x/bluetooth"
+)
+
+// bleScanTimeout bounds how long OpenBLE scans for the named device.
+const bleScanTimeout = 30 * time.Second
+
+var (
+	bleEnableOnce sync.Once
+	bleEnableErr  error
+)
+
+// bleTransport carries the companion protocol over the Nordic UART Service.
+// Over BLE each characteristic write or notification is one whole frame
+// without the serial '<'/'>' header and length, so the transport adds and
+// strips them to present the same byte stream as a serial port.
+type bleTransport struct {
+	device  bluetooth.Device
+	rx      bluetooth.DeviceCharacteristic // written by us
+	frames  chan []byte                    // notifications from the radio
+	pending []byte
+	timeout time.Duration
+}
+
+func openBLE(name string) (Transport, error) {
+	adapter := bluetooth.DefaultAdapter
+	bleEnableOnce.Do(func() { bleEnableErr = adapter.Enable() })
+	if bleEnableErr != nil {
+		return nil, fmt.Errorf("failed to enable bluetooth: %w", bleEnableErr)
+	}
+
+	var addr bluetooth.Address
+	found := false
+	timer := time.AfterFunc(bleScanTimeout, func() { adapter.StopScan() })
+	err := adapter.Scan(func(a *bluetooth.Adapter, res bluetooth.ScanResult) {
+		if res.LocalName() == name {
+			addr, found = res.Address, true
+			a.StopScan()
+		}
+	})
+	timer.Stop()
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan for %s: %w", name, err)
+	}
+	if !found {
+		return nil, fmt.Errorf("no BLE device named %q found within %s", name, bleScanTimeout)
+	}
+
+	device, err := adapter.Connect(addr, bluetooth.ConnectionParams{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", name, err)
+	}
+	t, err := newBLETransport(device)
+	if err != nil {
+		device.Disconnect()
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return t, nil
+}
+
+func newBLETransport(device bluetooth.Device) (*bleTransport, error) {
+	services, err := device.DiscoverServices([]bluetooth.UUID{bluetooth.ServiceUUIDNordicUART})
+	if err != nil || len(services) == 0 {
+		return nil, fmt.Errorf("no Nordic UART service: %v", err)
+	}
+	chars, err := services[0].DiscoverCharacteristics([]bluetooth.UUID{
+		bluetooth.CharacteristicUUIDUARTRX, bluetooth.CharacteristicUUIDUARTTX,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover UART characteristics: %w", err)
+	}
+
+	t := &bleTransport{device: device, frames: make(chan []byte, 64)}
+	var tx *bluetooth.DeviceCharacteristic
+	for i := range chars {
+		switch chars[i].UUID() {
+		case bluetooth.CharacteristicUUIDUARTRX:
+			t.rx = chars[i]
+		case bluetooth.CharacteristicUUIDUARTTX:
+			tx = &chars[i]
+		}
+	}
+	if tx == nil {
+		return nil, errors.New("no UART TX characteristic")
+	}
+	err = tx.EnableNotifications(func(buf []byte) {
+		frame := make([]byte, len(buf))
+		copy(frame, buf)
+		select {
+		case t.frames <- frame:
+		default:
+			// Nobody is reading; the frame would be stale by the time
+			// anyone does.
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to enable notifications: %w", err)
+	}
+	return t, nil
+}
+
+func (t *bleTransport) Read(p []byte) (int, error) {
+	if len(t.pending) == 0 {
+		var timeout <-chan time.Time
+		if t.timeout > 0 {
+			timer := time.NewTimer(t.timeout)
+			defer timer.Stop()
+			timeout = timer.C
+		}
+		select {
+		case frame := <-t.frames:
+			t.pending = encodeFrame(frameHeaderRx, frame)
+		case <-timeout:
+			return 0, nil
+		}
+	}
+	n := copy(p, t.pending)
+	t.pending = t.pending[n:]
+	return n, nil
+}
+
+// Write sends one framed command, as Radio writes them, as a single
+// characteristic write.
+func (t *bleTransport) Write(p []byte) (int, error) {
+	if len(p) < 3 || p[0] != frameHeaderTx {
+		return 0, errors.New("BLE writes must be whole command frames")
+	}
+	if _, err := t.rx.Write(p[3:]); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (t *bleTransport) SetReadTimeout(d time.Duration) error {
+	t.timeout = d
+	return nil
+}
+
+func (t *bleTransport) Close() error { return t.device.Disconnect() }
@@ -0,0 +1,159 @@
+package meshcore
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Contact types, from the node's advert.
+const (
+	ContactTypeNone     = 0
+	ContactTypeChat     = 1
+	ContactTypeRepeater = 2
+	ContactTypeRoom     = 3
+	ContactTypeSensor   = 4
+)
+
+// ContactTypeName returns a label-friendly name for a contact type.
+func ContactTypeName(t uint8) string {
+	switch t {
+	case ContactTypeNone:
+		return "none"
+	case ContactTypeChat:
+		return "companion"
+	case ContactTypeRepeater:
+		return "repeater"
+	case ContactTypeRoom:
+		return "room_server"
+	case ContactTypeSensor:
+		return "sensor"
+	}
+	return fmt.Sprintf("unknown_%d", t)
+}
+
+// FindContact resolves query against contacts. An exact (case-insensitive)
+// name match wins, then a 1-based index as shown in contact listings, then a
+// unique case-insensitive name prefix. An ambiguous prefix returns an error
+// listing the candidates.
+func FindContact(contacts []Contact, query string) (*Contact, error) {
+	for i := range contacts {
+		if strings.EqualFold(contacts[i].Name, query) {
+			return &contacts[i], nil
+		}
+	}
+
+	if n, err := strconv.Atoi(query); err == nil {
+		if n < 1 || n > len(contacts) {
+			return nil, fmt.Errorf("contact index %d out of range (1-%d)", n, len(contacts))
+		}
+		return &contacts[n-1], nil
+	}
+
+	lower := strings.ToLower(query)
+	var matches []*Contact
+	for i := range contacts {
+		if strings.HasPrefix(strings.ToLower(contacts[i].Name), lower) {
+			matches = append(matches, &contacts[i])
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("no contact matches %q", query)
+	case 1:
+		return matches[0], nil
+	}
+	names := make([]string, len(matches))
+	for i, c := range matches {
+		names[i] = c.Name
+	}
+	return nil, fmt.Errorf("%q is ambiguous, matches: %s", query, strings.Join(names, ", "))
+}
+
+// contactJSON is the on-disk form of a Contact, with the public key hex
+// encoded so cache files stay readable.
+type contactJSON struct {
+	Name       string  `json:"name"`
+	PubKey     string  `json:"pub_key"`
+	Type       uint8   `json:"type"`
+	Flags      uint8   `json:"flags"`
+	OutPathLen int8    `json:"out_path_len"`
+	Lat        float64 `json:"lat,omitempty"`
+	Lon        float64 `json:"lon,omitempty"`
+}
+
+func (c Contact) MarshalJSON() ([]byte, error) {
+	return json.Marshal(contactJSON{
+		Name:       c.Name,
+		PubKey:     hex.EncodeToString(c.PubKey[:]),
+		Type:       c.Type,
+		Flags:      c.Flags,
+		OutPathLen: c.OutPathLen,
+		Lat:        c.Lat,
+		Lon:        c.Lon,
+	})
+}
+
+func (c *Contact) UnmarshalJSON(data []byte) error {
+	var j contactJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	key, err := hex.DecodeString(j.PubKey)
+	if err != nil {
+		return fmt.Errorf("contact %q: invalid pub_key: %w", j.Name, err)
+	}
+	if len(key) != PubKeySize {
+		return fmt.Errorf("contact %q: pub_key is %d bytes, want %d", j.Name, len(key), PubKeySize)
+	}
+	*c = Contact{
+		Type:       j.Type,
+		Flags:      j.Flags,
+		Name:       j.Name,
+		OutPathLen: j.OutPathLen,
+		Lat:        j.Lat,
+		Lon:        j.Lon,
+	}
+	copy(c.PubKey[:], key)
+	return nil
+}
+
+// SaveContacts writes contacts to path as JSON. The file is written to a
+// temporary name and renamed into place so a crash never leaves a truncated
+// cache behind.
+func SaveContacts(path string, contacts []Contact) error {
+	data, err := json.MarshalIndent(contacts, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// LoadContacts reads a contacts list previously written by SaveContacts.
+func LoadContacts(path string) ([]Contact, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var contacts []Contact
+	if err := json.Unmarshal(data, &contacts); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", path, err)
+	}
+	return contacts, nil
+}
@@ -0,0 +1,55 @@
+package meshcore
+
+import (
+	"hash/crc32"
+	"time"
+)
+
+const (
+	// DefaultDedupWindow is how long a packet counts as a duplicate of one
+	// already observed. Floods reach a radio through each neighbour within a
+	// few seconds of each other.
+	DefaultDedupWindow = time.Minute
+	// dedupCapacity bounds the seen set on a busy mesh; the oldest packets
+	// are forgotten first.
+	dedupCapacity = 512
+)
+
+// packetDedup remembers recently observed packets so one flooded by several
+// neighbours is counted once. It is only used with Radio.mu held.
+type packetDedup struct {
+	window time.Duration
+	seen   map[uint32]time.Time
+	order  []uint32 // hashes in the order first seen
+}
+
+// duplicate reports whether a packet with hash h was already seen within
+// the window, and records it if not.
+func (d *packetDedup) duplicate(h uint32, now time.Time) bool {
+	if d.window <= 0 {
+		return false
+	}
+	if d.seen == nil {
+		d.seen = make(map[uint32]time.Time)
+	}
+	for len(d.order) > 0 && (len(d.order) >= dedupCapacity || now.Sub(d.seen[d.order[0]]) >= d.window) {
+		delete(d.seen, d.order[0])
+		d.order = d.order[1:]
+	}
+	if _, ok := d.seen[h]; ok {
+		return true
+	}
+	d.seen[h] = now
+	d.order = append(d.order, h)
+	return false
+}
+
+// rxPacketHash hashes the payload type and payload of an rx log push. The
+// header's route bits and the path change as a packet is relayed, so they
+// are left out, as in the firmware's own duplicate check.
+func rxPacketHash(data []byte, e *RxLogEntry) uint32 {
+	h := crc32.NewIEEE()
+	h.Write([]byte{e.PayloadType})
+	h.Write(data[3+2+e.PathLen:])
+	return h.Sum32()
+}
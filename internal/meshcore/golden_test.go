@@ -0,0 +1,390 @@
+package meshcore
+
+import (
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type goldenFrame struct {
+	name    string
+	frame   []byte
+	parse   func([]byte) (any, error)
+	want    any
+	wantErr bool
+}
+
+// statusResult bundles the three values returned by ParseStatusResponse.
+type statusResult struct {
+	Core    *StatsCore
+	Radio   *StatsRadio
+	Packets *StatsPackets
+}
+
+// ownerInfoResult bundles the strings returned by ParseOwnerInfoResponse.
+type ownerInfoResult struct {
+	Version, NodeName, OwnerInfo string
+}
+
+// unhex decodes a hex string, ignoring spaces so frames can be laid out
+// field by field. The result's capacity equals its length so a parser that
+// reads past the end of a short frame panics, failing the test, instead of
+// seeing spare bytes.
+func unhex(s string) []byte {
+	b, err := hex.DecodeString(strings.ReplaceAll(s, " ", ""))
+	if err != nil {
+		panic(fmt.Sprintf("bad golden frame %q: %v", s, err))
+	}
+	return b[:len(b):len(b)]
+}
+
+// goldenFrames are reference frames, laid out field by field, that document
+// the wire format each parser expects along with the decoded result.
+var goldenFrames = []goldenFrame{
+	{
+		name: "stats core",
+		frame: unhex("18 00" + // RespCodeStats, StatsTypeCore
+			" 04 10" + // battery_mv = 4100
+			" 80 51 01 00" + // uptime_secs = 86400
+			" 02 00" + // error flags = 0x0002
+			" 03"), // queue_len = 3
+		parse: func(b []byte) (any, error) { return ParseStatsCore(b) },
+		want:  &StatsCore{BatteryMV: 4100, UptimeSecs: 86400, Errors: 2, QueueLen: 3},
+	},
+	{
+		name: "stats core with temperature",
+		frame: unhex("18 00 04 10 80 51 01 00 02 00 03" +
+			" 06 FF"), // temperature = -2.50 C
+		parse: func(b []byte) (any, error) { return ParseStatsCore(b) },
+		want:  &StatsCore{BatteryMV: 4100, UptimeSecs: 86400, Errors: 2, QueueLen: 3, TemperatureC: -2.5, HasTemp: true},
+	},
+	{
+		name:    "stats core wrong type",
+		frame:   unhex("18 01 04 10 80 51 01 00 02 00 03"),
+		parse:   func(b []byte) (any, error) { return ParseStatsCore(b) },
+		wantErr: true,
+	},
+	{
+		name: "stats radio",
+		frame: unhex("18 01" + // RespCodeStats, StatsTypeRadio
+			" 92 FF" + // noise_floor = -110
+			" AB" + // last_rssi = -85
+			" 1D" + // last_snr*4 = 29
+			" 10 0E 00 00" + // tx_air_secs = 3600
+			" 20 1C 00 00"), // rx_air_secs = 7200
+		parse: func(b []byte) (any, error) { return ParseStatsRadio(b) },
+		want:  &StatsRadio{NoiseFloor: -110, LastRSSI: -85, LastSNR: 7.25, TxAirSecs: 3600, RxAirSecs: 7200},
+	},
+	{
+		name: "stats packets",
+		frame: unhex("18 02" + // RespCodeStats, StatsTypePackets
+			" E8 03 00 00" + // recv = 1000
+			" F4 01 00 00" + // sent = 500
+			" 2C 01 00 00" + // flood_tx = 300
+			" C8 00 00 00" + // direct_tx = 200
+			" BC 02 00 00" + // flood_rx = 700
+			" 2C 01 00 00"), // direct_rx = 300
+		parse: func(b []byte) (any, error) { return ParseStatsPackets(b) },
+		want:  &StatsPackets{Recv: 1000, Sent: 500, FloodTx: 300, DirectTx: 200, FloodRx: 700, DirectRx: 300},
+	},
+	{
+		name: "self info",
+		frame: unhex("05" + // RespCodeSelfInfo
+			" 01" + // adv_type
+			" 14" + // tx_power = 20
+			" 16" + // max_tx_power = 22
+			" 0102030405060708090A0B0C0D0E0F101112131415161718191A1B1C1D1E1F20" + // pub_key
+			" 80 87 B0 02" + // lat = 45.123456
+			" CF F2 6A FA" + // lon = -93.654321
+			" 00 00 00 00" + // flags
+			" BD E4 0D 00" + // freq = 910525 kHz
+			" 24 F4 00 00" + // bw = 62500 Hz
+			" 07" + // sf
+			" 05" + // cr
+			" 436F6D70616E696F6E"), // name = "Companion"
+		parse: func(b []byte) (any, error) { return ParseSelfInfo(b) },
+		want: &SelfInfo{
+			PubKey:  [PubKeySize]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31, 32},
+			Name:    "Companion",
+			Lat:     45.123456,
+			Lon:     -93.654321,
+			TxPower: 20,
+			MaxTx:   22,
+			FreqKHz: 910525,
+			BwHz:    62500,
+			SF:      7,
+			CR:      5,
+		},
+	},
+	{
+		name:    "self info truncated",
+		frame:   unhex("05 01 14 16"),
+		parse:   func(b []byte) (any, error) { return ParseSelfInfo(b) },
+		wantErr: true,
+	},
+	{
+		name: "device info",
+		frame: unhex("0D" + // RespCodeDeviceInfo
+			" 03" + // firmware_ver_code
+			" 32" + // max_contacts/2 = 50
+			" 08" + // max_channels
+			" 00 00 00 00" + // ble_pin
+			" 3139204A616E2032303235 00" + // build_date (12) = "19 Jan 2025"
+			" 48656C7465632056330000" + strings.Repeat("00", 29) + // model (40) = "Heltec V3"
+			" 76312E392E30" + strings.Repeat("00", 14)), // version (20) = "v1.9.0"
+		parse: func(b []byte) (any, error) { return ParseDeviceInfo(b) },
+		want: &DeviceInfo{
+			FirmwareCode: 3,
+			MaxContacts:  100,
+			MaxChannels:  8,
+			BuildDate:    "19 Jan 2025",
+			Model:        "Heltec V3",
+			Version:      "v1.9.0",
+		},
+	},
+	{
+		name: "battery",
+		frame: unhex("0C" + // RespCodeBattery
+			" 68 10" + // battery_mv = 4200
+			" 00 01 00 00" + // storage used (KB)
+			" 00 10 00 00"), // storage total (KB)
+		parse: func(b []byte) (any, error) { return ParseBattery(b) },
+		want:  uint16(4200),
+	},
+	{
+		name:  "contacts start",
+		frame: unhex("02 03 00 00 00"), // RespCodeContactsStart, count = 3
+		parse: func(b []byte) (any, error) { return ParseContactsStart(b) },
+		want:  uint32(3),
+	},
+	{
+		name: "contact",
+		frame: unhex("03" + // RespCodeContact
+			" A1A2A3A4A5A6A7A8A9AAABACADAEAFB0B1B2B3B4B5B6B7B8B9BABBBCBDBEBFC0" + // pub_key
+			" 02" + // type = repeater
+			" 00" + // flags
+			" 02" + // out_path_len = 2
+			" 3C 7F" + strings.Repeat("00", 62) + // out_path (64)
+			" 466F782052756E205265706561746572" + strings.Repeat("00", 16) + // name (32) = "Fox Run Repeater"
+			" 00 00 00 00" + // last_advert_ts
+			" 80 B2 B1 02" + // lat = 45.2
+			" A0 4D 6D FA" + // lon = -93.5
+			" 00 00 00 00"), // lastmod
+		parse: func(b []byte) (any, error) { return ParseContact(b) },
+		want: &Contact{
+			PubKey: [PubKeySize]byte{
+				0xA1, 0xA2, 0xA3, 0xA4, 0xA5, 0xA6, 0xA7, 0xA8, 0xA9, 0xAA, 0xAB, 0xAC, 0xAD, 0xAE, 0xAF, 0xB0,
+				0xB1, 0xB2, 0xB3, 0xB4, 0xB5, 0xB6, 0xB7, 0xB8, 0xB9, 0xBA, 0xBB, 0xBC, 0xBD, 0xBE, 0xBF, 0xC0,
+			},
+			Type:       2,
+			Name:       "Fox Run Repeater",
+			OutPathLen: 2,
+			Lat:        45.2,
+			Lon:        -93.5,
+		},
+	},
+	{
+		name: "sent",
+		frame: unhex("06" + // RespCodeSent
+			" 01" + // flood
+			" 78 56 34 12" + // tag = 0x12345678
+			" 88 13 00 00"), // timeout = 5000 ms
+		parse: func(b []byte) (any, error) {
+			isFlood, tag, timeout, err := ParseSentResponse(b)
+			return []any{isFlood, tag, timeout}, err
+		},
+		want: []any{true, uint32(0x12345678), uint32(5000)},
+	},
+	{
+		name: "login success",
+		frame: unhex("85" + // PushCodeLoginSuccess
+			" 01" + // permissions
+			" A1 A2 A3 A4 A5 A6"), // pub_key prefix
+		parse: func(b []byte) (any, error) { return ParseLoginSuccess(b) },
+		want:  []byte{0xA1, 0xA2, 0xA3, 0xA4, 0xA5, 0xA6},
+	},
+	{
+		name: "login fail sender",
+		frame: unhex("86" + // PushCodeLoginFail
+			" 00" + // reserved
+			" B1 B2 B3 B4 B5 B6"), // pub_key prefix
+		parse: func(b []byte) (any, error) { return PushSenderPrefix(b) },
+		want:  []byte{0xB1, 0xB2, 0xB3, 0xB4, 0xB5, 0xB6},
+	},
+	{
+		name: "binary response tag",
+		frame: unhex("8C" + // PushCodeBinaryResponse
+			" 00" + // reserved
+			" 78 56 34 12" + // tag
+			" 01 67 00 FA"), // response data
+		parse: func(b []byte) (any, error) { return PushTag(b) },
+		want:  uint32(0x12345678),
+	},
+	{
+		name: "login fail reason",
+		frame: unhex("86" + // PushCodeLoginFail
+			" 00" + // reason (reserved in current firmware)
+			" B1 B2 B3 B4 B5 B6"), // pub_key prefix
+		parse: func(b []byte) (any, error) { return ParseLoginFail(b) },
+		want:  uint8(0),
+	},
+	{
+		name: "status response",
+		frame: unhex("87" + // PushCodeStatusResponse
+			" 00" + // reserved
+			" A1 A2 A3 A4 A5 A6" + // pub_key prefix
+			" 04 10" + // battery_mv = 4100
+			" 03 00" + // queue_len = 3
+			" 92 FF" + // noise_floor = -110
+			" AB FF" + // last_rssi = -85
+			" E8 03 00 00" + // recv = 1000
+			" F4 01 00 00" + // sent = 500
+			" 10 0E 00 00" + // tx_air_secs = 3600
+			" 80 51 01 00" + // uptime_secs = 86400
+			" 2C 01 00 00" + // flood_tx = 300
+			" C8 00 00 00" + // direct_tx = 200
+			" BC 02 00 00" + // flood_rx = 700
+			" 2C 01 00 00" + // direct_rx = 300
+			" 02 00" + // err_events = cad_timeout
+			" 1D 00" + // last_snr*4 = 29
+			" 05 00 07 00" + // direct_dups, flood_dups (unparsed)
+			" 20 1C 00 00"), // rx_air_secs = 7200
+		parse: func(b []byte) (any, error) {
+			core, radio, packets, err := ParseStatusResponse(b)
+			return &statusResult{core, radio, packets}, err
+		},
+		want: &statusResult{
+			Core:    &StatsCore{BatteryMV: 4100, UptimeSecs: 86400, Errors: 2, QueueLen: 3},
+			Radio:   &StatsRadio{NoiseFloor: -110, LastRSSI: -85, LastSNR: 7.25, TxAirSecs: 3600, RxAirSecs: 7200},
+			Packets: &StatsPackets{Recv: 1000, Sent: 500, FloodTx: 300, DirectTx: 200, FloodRx: 700, DirectRx: 300},
+		},
+	},
+	{
+		name: "status response without rx airtime",
+		frame: unhex("87 00 A1 A2 A3 A4 A5 A6" +
+			" 04 10 00 00 92 FF AB FF" + // battery, queue, noise_floor, last_rssi
+			strings.Repeat("00", 32) + // counters, airtime, uptime
+			" 00 00" + // err_events
+			" EC FF"), // last_snr*4 = -20
+		parse: func(b []byte) (any, error) {
+			_, radio, _, err := ParseStatusResponse(b)
+			return radio, err
+		},
+		want: &StatsRadio{NoiseFloor: -110, LastRSSI: -85, LastSNR: -5},
+	},
+	{
+		name:    "status response short",
+		frame:   unhex("87 00 A1 A2 A3 A4 A5 A6" + strings.Repeat("00", 42)), // 50 bytes, ends inside last_snr
+		parse:   func(b []byte) (any, error) { _, _, _, err := ParseStatusResponse(b); return nil, err },
+		wantErr: true,
+	},
+	{
+		name: "rx log",
+		frame: unhex("88" + // PushCodeLogRxData
+			" F6" + // snr*4 = -10 -> -2.5 dB
+			" A6" + // rssi = -90
+			" 11" + // header: route type 1 (flood), payload type 4 (advert)
+			" 02" + // path_len
+			" 3C 7E" + // path, first hop 0x3C
+			" DE AD BE EF"), // payload
+		parse: func(b []byte) (any, error) { return ParseLogRxData(b) },
+		want: &RxLogEntry{
+			SNR:         -2.5,
+			RSSI:        -90,
+			RouteType:   1,
+			PayloadType: 4,
+			PathLen:     2,
+			FirstHop:    0x3C,
+			PayloadSize: 4,
+		},
+	},
+	{
+		name:    "rx log path overrun",
+		frame:   unhex("88 F6 A6 11 05 3C"),
+		parse:   func(b []byte) (any, error) { return ParseLogRxData(b) },
+		wantErr: true,
+	},
+	{
+		name: "telemetry",
+		frame: unhex("8C" + // PushCodeBinaryResponse
+			" 00" + // reserved
+			" 01 02 03 04" + // tag
+			" 01 74 01 A0" + // channel 1 voltage = 4.16 V
+			" 02 67 00 E1"), // channel 2 temperature = 22.5 C
+		parse: func(b []byte) (any, error) { return ParseTelemetryResponse(b) },
+		want: &TelemetryData{BatteryVolts: 4.16, Temperature: 22.5, HasTemp: true, Channels: []TelemetryReading{
+			{Channel: 1, Type: LPPVoltage, Value: 4.16},
+			{Channel: 2, Type: LPPTemperature, Value: 22.5},
+		}},
+	},
+	{
+		name: "telemetry push with sensors",
+		frame: unhex("8B" + // PushCodeTelemetryResponse
+			" 00" + // reserved
+			" A1 A2 A3 A4 A5 A6" + // sender prefix
+			" 01 74 01 9A" + // channel 1 voltage = 4.10 V
+			" 02 68 91" + // channel 2 humidity = 72.5 %
+			" 02 88 00 00 00 00 00 00 00 00 00" + // channel 2 GPS, skipped
+			" 03 74 04 B0" + // channel 3 voltage = 12.00 V
+			" 00 00"), // padding
+		parse: func(b []byte) (any, error) { return ParseTelemetryResponse(b) },
+		want: &TelemetryData{BatteryVolts: 4.10, Channels: []TelemetryReading{
+			{Channel: 1, Type: LPPVoltage, Value: 4.10},
+			{Channel: 2, Type: LPPHumidity, Value: 72.5},
+			{Channel: 3, Type: LPPVoltage, Value: 12},
+		}},
+	},
+	{
+		name: "owner info",
+		frame: unhex("8C" + // PushCodeBinaryResponse
+			" A1 A2 A3 A4 A5 A6" + // sender prefix
+			" 00" + // reserved
+			" 00 00 00 00" + // timestamp
+			" 76312E392E300A466F782052756E205265706561746572" + // "v1.9.0\nFox Run Repeater"
+			" 0A6F7073406578616D706C652E6F7267"), // "\nops@example.org"
+		parse: func(b []byte) (any, error) {
+			version, nodeName, ownerInfo, err := ParseOwnerInfoResponse(b)
+			return &ownerInfoResult{version, nodeName, ownerInfo}, err
+		},
+		want: &ownerInfoResult{Version: "v1.9.0", NodeName: "Fox Run Repeater", OwnerInfo: "ops@example.org"},
+	},
+	{
+		name:  "version",
+		frame: unhex("08 76312E392E30 00"), // RespCodeVersion, "v1.9.0"
+		parse: func(b []byte) (any, error) { return ParseVersion(b) },
+		want:  "v1.9.0",
+	},
+}
+
+// TestGoldenFrames decodes every golden frame with its parser and checks
+// the result against the expected value.
+func TestGoldenFrames(t *testing.T) {
+	for _, g := range goldenFrames {
+		t.Run(g.name, func(t *testing.T) {
+			got, err := g.parse(g.frame)
+			if g.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %s", describe(got))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, g.want) {
+				t.Errorf("got %s, want %s", describe(got), describe(g.want))
+			}
+		})
+	}
+}
+
+// describe formats a decoded value, following pointers so mismatches show
+// field values rather than addresses.
+func describe(v any) string {
+	if r, ok := v.(*statusResult); ok && r != nil {
+		return fmt.Sprintf("{Core:%+v Radio:%+v Packets:%+v}", r.Core, r.Radio, r.Packets)
+	}
+	return fmt.Sprintf("%+v", v)
+}
@@ -0,0 +1,22 @@
+package meshcore
+
+import "math"
+
+// SymbolTime returns the LoRa symbol duration in seconds for the given
+// bandwidth and spreading factor: 2^SF / BW.
+func SymbolTime(bwHz uint32, sf uint8) float64 {
+	if bwHz == 0 {
+		return 0
+	}
+	return math.Ldexp(1, int(sf)) / float64(bwHz)
+}
+
+// DataRate returns the nominal LoRa bitrate in bits per second. cr is the
+// coding rate denominator as used by the radio (5-8 for 4/5 through 4/8).
+func DataRate(bwHz uint32, sf uint8, cr uint8) float64 {
+	ts := SymbolTime(bwHz, sf)
+	if ts == 0 || cr == 0 {
+		return 0
+	}
+	return float64(sf) / ts * 4.0 / float64(cr)
+}
@@ -0,0 +1,147 @@
+// Package meshcoretest provides an in-memory meshcore.Transport for driving
+// a Radio without hardware.
+package meshcoretest
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/watsoncj/meshcore-stats/internal/meshcore"
+)
+
+// MockTransport replays queued bytes to the Radio and records everything it
+// writes. Once the queue is empty, reads wait for more bytes up to the read
+// timeout and then return (0, nil), as an idle serial port does.
+type MockTransport struct {
+	mu      sync.Mutex
+	rx      []byte
+	written []byte
+	closed  bool
+	timeout time.Duration
+	// queued is signalled when bytes are enqueued, waking a waiting Read.
+	queued chan struct{}
+}
+
+var _ meshcore.Transport = (*MockTransport)(nil)
+
+// New returns an empty MockTransport.
+func New() *MockTransport {
+	return &MockTransport{timeout: meshcore.DefaultReadTimeout, queued: make(chan struct{}, 1)}
+}
+
+// Radio returns a Radio framed over m. Reconnecting the radio reopens m
+// without discarding queued or written bytes.
+func (m *MockTransport) Radio() *meshcore.Radio {
+	r, _ := meshcore.OpenTransport(func() (meshcore.Transport, error) {
+		m.mu.Lock()
+		m.closed = false
+		m.mu.Unlock()
+		return m, nil
+	})
+	return r
+}
+
+// EnqueueFrame queues payload as a radio-to-host frame, adding the '>'
+// header and little-endian length.
+func (m *MockTransport) EnqueueFrame(payload []byte) {
+	frame := make([]byte, 3+len(payload))
+	frame[0] = '>'
+	binary.LittleEndian.PutUint16(frame[1:3], uint16(len(payload)))
+	copy(frame[3:], payload)
+	m.Enqueue(frame)
+}
+
+// Enqueue queues raw bytes exactly as given, for exercising malformed input.
+func (m *MockTransport) Enqueue(b []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rx = append(m.rx, b...)
+	select {
+	case m.queued <- struct{}{}:
+	default:
+	}
+}
+
+// Written returns a copy of every byte written so far.
+func (m *MockTransport) Written() []byte {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]byte(nil), m.written...)
+}
+
+// Commands splits the written bytes into host-to-radio frames and returns
+// their payloads, without the '<' header and length. A trailing partial
+// frame is dropped.
+func (m *MockTransport) Commands() [][]byte {
+	b := m.Written()
+	var cmds [][]byte
+	for len(b) >= 3 && b[0] == '<' {
+		n := int(binary.LittleEndian.Uint16(b[1:3]))
+		if len(b) < 3+n {
+			break
+		}
+		cmds = append(cmds, b[3:3+n])
+		b = b[3+n:]
+	}
+	return cmds
+}
+
+// Reset discards queued and written bytes.
+func (m *MockTransport) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rx = nil
+	m.written = nil
+}
+
+func (m *MockTransport) Read(p []byte) (int, error) {
+	m.mu.Lock()
+	timer := time.NewTimer(m.timeout)
+	m.mu.Unlock()
+	defer timer.Stop()
+	for {
+		m.mu.Lock()
+		if m.closed {
+			m.mu.Unlock()
+			return 0, errors.New("read from closed transport")
+		}
+		if len(m.rx) > 0 {
+			n := copy(p, m.rx)
+			m.rx = m.rx[n:]
+			m.mu.Unlock()
+			return n, nil
+		}
+		m.mu.Unlock()
+		select {
+		case <-m.queued:
+		case <-timer.C:
+			return 0, nil
+		}
+	}
+}
+
+func (m *MockTransport) Write(p []byte) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return 0, errors.New("write to closed transport")
+	}
+	m.written = append(m.written, p...)
+	return len(p), nil
+}
+
+func (m *MockTransport) SetReadTimeout(t time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.timeout = t
+	return nil
+}
+
+func (m *MockTransport) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closed = true
+	return nil
+}
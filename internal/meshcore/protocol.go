@@ -4,26 +4,56 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"slices"
 	"strings"
+	"time"
 )
 
 const (
 	CmdAppStart        = 1
+	CmdSendTxtMsg      = 2
 	CmdGetContacts     = 4
+	CmdSendSelfAdvert  = 7
 	CmdGetVersion      = 10
 	CmdSetRadioParams  = 11
 	CmdSetRadioTxPower = 12
 	CmdReboot          = 19
+	CmdGetBattery      = 20
+	CmdDeviceQuery     = 22
 	CmdSendLogin       = 26
 	CmdSendStatusReq   = 27
 	CmdSendBinaryReq   = 50
 	CmdGetStats        = 56
 
-	ReqTypeGetOwnerInfo      = 0x07
-	ReqTypeGetTelemetryData  = 0x03
+	ReqTypeGetOwnerInfo     = 0x07
+	ReqTypeGetTelemetryData = 0x03
 
-	LPPVoltage     = 0x74
-	LPPTemperature = 0x67
+	TxtTypePlain   = 0
+	TxtTypeCLIData = 1
+
+	// DefaultAppName is the client name sent with AppStart.
+	DefaultAppName = "mccli"
+	// MaxAppNameLen is the longest client name that fits in the firmware's
+	// 172-byte command frame after the AppStart header.
+	MaxAppNameLen = 172 - 8
+
+	// MaxTextMessageLen is the longest text message body the firmware sends.
+	MaxTextMessageLen = 160
+
+	// Bounds accepted by the repeater CLI for "set advert.interval" (0 disables).
+	MinAdvertIntervalMins = 60
+	MaxAdvertIntervalMins = 240
+
+	LPPDigitalInput  = 0x00
+	LPPAnalogInput   = 0x02
+	LPPIlluminance   = 0x65
+	LPPTemperature   = 0x67
+	LPPHumidity      = 0x68
+	LPPAccelerometer = 0x71
+	LPPBarometer     = 0x73
+	LPPVoltage       = 0x74
+	LPPCurrent       = 0x75
+	LPPGPS           = 0x88
 
 	StatsTypeCore    = 0
 	StatsTypeRadio   = 1
@@ -37,18 +67,28 @@ const (
 	RespCodeSelfInfo      = 5
 	RespCodeSent          = 6
 	RespCodeVersion       = 8
+	RespCodeBattery       = 12
+	RespCodeDeviceInfo    = 13
 	RespCodeStats         = 24
 
-	PushCodeLoginSuccess    = 0x85
-	PushCodeLoginFail       = 0x86
-	PushCodeStatusResponse  = 0x87
-	PushCodeLogRxData       = 0x88
-	PushCodeBinaryResponse  = 0x8C
+	PushCodeSendConfirmed     = 0x82
+	PushCodeLoginSuccess      = 0x85
+	PushCodeLoginFail         = 0x86
+	PushCodeStatusResponse    = 0x87
+	PushCodeLogRxData         = 0x88
+	PushCodeTelemetryResponse = 0x8B
+	PushCodeBinaryResponse    = 0x8C
 
 	PubKeySize       = 32
 	StatsCoreSize    = 11
 	StatsRadioSize   = 14
 	StatsPacketsSize = 26
+
+	// StatusResponseSize covers the status push header and the repeater
+	// stats through last_snr. Newer firmware appends duplicate counters and
+	// then the rx airtime, which is read when present.
+	StatusResponseSize = 52
+	statusRxAirOffset  = 56
 )
 
 type Contact struct {
@@ -68,12 +108,147 @@ type SelfInfo struct {
 	Lon     float64
 	TxPower uint8
 	MaxTx   uint8
+	FreqKHz uint32
+	BwHz    uint32
+	SF      uint8
+	CR      uint8
+}
+
+// DeviceInfo is the companion radio's response to a device query. Fields
+// beyond FirmwareCode are only reported by firmware code 3 and later.
+type DeviceInfo struct {
+	FirmwareCode uint8
+	MaxContacts  int
+	MaxChannels  int
+	BuildDate    string
+	Model        string
+	Version      string
+}
+
+// lppSizes is the data length of each Cayenne LPP type the parser can step
+// over.
+var lppSizes = map[byte]int{
+	LPPDigitalInput:  1,
+	LPPAnalogInput:   2,
+	LPPIlluminance:   2,
+	LPPTemperature:   2,
+	LPPHumidity:      1,
+	LPPAccelerometer: 6,
+	LPPBarometer:     2,
+	LPPVoltage:       2,
+	LPPCurrent:       2,
+	LPPGPS:           9,
+}
+
+// TelemetryReading is one scalar LPP record from a telemetry response.
+type TelemetryReading struct {
+	Channel uint8
+	Type    uint8 // LPP type, e.g. LPPVoltage
+	Value   float64
 }
 
 type TelemetryData struct {
+	// BatteryVolts and Temperature are the first voltage and temperature
+	// records, which the firmware reports for the node itself on channel 1.
 	BatteryVolts float64
 	Temperature  float64
 	HasTemp      bool
+	Channels     []TelemetryReading
+}
+
+// RxLogEntry is a packet the companion radio overheard, from a
+// PushCodeLogRxData push.
+type RxLogEntry struct {
+	SNR         float64
+	RSSI        int8
+	RouteType   uint8 // header bits 0-1
+	PayloadType uint8 // header bits 2-5
+	PathLen     int
+	// FirstHop is the path hash of the node the packet was received from,
+	// valid when PathLen > 0.
+	FirstHop    byte
+	PayloadSize int
+}
+
+// RouteTypeName returns a label-friendly name for a packet's route type.
+func RouteTypeName(t uint8) string {
+	switch t {
+	case 0:
+		return "transport_flood"
+	case 1:
+		return "flood"
+	case 2:
+		return "direct"
+	case 3:
+		return "transport_direct"
+	}
+	return fmt.Sprintf("unknown_%d", t)
+}
+
+var commandNames = map[byte]string{
+	CmdAppStart:        "app_start",
+	CmdSendTxtMsg:      "send_txt_msg",
+	CmdGetContacts:     "get_contacts",
+	CmdSendSelfAdvert:  "send_self_advert",
+	CmdGetVersion:      "get_version",
+	CmdSetRadioParams:  "set_radio_params",
+	CmdSetRadioTxPower: "set_radio_tx_power",
+	CmdReboot:          "reboot",
+	CmdGetBattery:      "get_battery",
+	CmdDeviceQuery:     "device_query",
+	CmdSendLogin:       "send_login",
+	CmdSendStatusReq:   "send_status_req",
+	CmdSendBinaryReq:   "send_binary_req",
+	CmdGetStats:        "get_stats",
+}
+
+// CommandName returns a label-friendly name for a command code.
+func CommandName(cmd byte) string {
+	if name, ok := commandNames[cmd]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown_%d", cmd)
+}
+
+var pushCodeNames = map[byte]string{
+	PushCodeSendConfirmed:     "send_confirmed",
+	PushCodeLoginSuccess:      "login_success",
+	PushCodeLoginFail:         "login_fail",
+	PushCodeStatusResponse:    "status_response",
+	PushCodeLogRxData:         "log_rx_data",
+	PushCodeTelemetryResponse: "telemetry_response",
+	PushCodeBinaryResponse:    "binary_response",
+}
+
+// PushCodeName returns a label-friendly name for a push code.
+func PushCodeName(code byte) string {
+	if name, ok := pushCodeNames[code]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown_0x%02X", code)
+}
+
+var payloadTypeNames = map[uint8]string{
+	0x00: "request",
+	0x01: "response",
+	0x02: "text",
+	0x03: "ack",
+	0x04: "advert",
+	0x05: "group_text",
+	0x06: "group_data",
+	0x07: "anon_request",
+	0x08: "path",
+	0x09: "trace",
+	0x0A: "multipart",
+	0x0F: "raw_custom",
+}
+
+// PayloadTypeName returns a label-friendly name for a packet's payload type.
+func PayloadTypeName(t uint8) string {
+	if name, ok := payloadTypeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown_%d", t)
 }
 
 type StatsCore struct {
@@ -81,6 +256,10 @@ type StatsCore struct {
 	UptimeSecs uint32
 	Errors     uint16
 	QueueLen   uint8
+	// TemperatureC is only reported by newer firmware; HasTemp says whether
+	// the frame carried it.
+	TemperatureC float64
+	HasTemp      bool
 }
 
 type StatsRadio struct {
@@ -100,6 +279,9 @@ type StatsPackets struct {
 	DirectRx uint32
 }
 
+// BuildGetStatsCmd requests a single stats type. The firmware reads only the
+// byte after the command code and replies with one stats frame, so core,
+// radio and packet stats can't be batched into one round trip.
 func BuildGetStatsCmd(statsType uint8) []byte {
 	return []byte{CmdGetStats, statsType}
 }
@@ -108,14 +290,24 @@ func BuildGetVersionCmd() []byte {
 	return []byte{CmdGetVersion}
 }
 
-func BuildAppStartCmd() []byte {
-	cmd := make([]byte, 11)
+// BuildAppStartCmd builds the command a client opens its session with: the
+// app version, six reserved bytes, then the client name, truncated to
+// MaxAppNameLen.
+func BuildAppStartCmd(name string) []byte {
+	if len(name) > MaxAppNameLen {
+		name = name[:MaxAppNameLen]
+	}
+	cmd := make([]byte, 8+len(name))
 	cmd[0] = CmdAppStart
 	cmd[1] = 0x03
-	copy(cmd[2:], []byte("mccli"))
+	copy(cmd[8:], name)
 	return cmd
 }
 
+func BuildDeviceQueryCmd() []byte {
+	return []byte{CmdDeviceQuery, 0x03}
+}
+
 func BuildGetContactsCmd() []byte {
 	return []byte{CmdGetContacts}
 }
@@ -151,6 +343,44 @@ func BuildSendTelemetryReqCmd(pubKey []byte) []byte {
 	return cmd
 }
 
+// buildSendTxtMsgCmd builds a text message command addressed to the first
+// six bytes of the recipient's public key.
+func buildSendTxtMsgCmd(txtType uint8, pubKey []byte, text string, timestamp uint32) []byte {
+	cmd := make([]byte, 13+len(text))
+	cmd[0] = CmdSendTxtMsg
+	cmd[1] = txtType
+	cmd[2] = 0 // attempt
+	binary.LittleEndian.PutUint32(cmd[3:7], timestamp)
+	copy(cmd[7:13], pubKey)
+	copy(cmd[13:], text)
+	return cmd
+}
+
+// BuildSendTextMessageCmd builds a plain text message to the contact whose
+// public key starts with pubKey, stamped with the current time.
+func BuildSendTextMessageCmd(pubKey []byte, text string) []byte {
+	return buildSendTxtMsgCmd(TxtTypePlain, pubKey, text, uint32(time.Now().Unix()))
+}
+
+// BuildSetAdvertIntervalCmd builds a remote CLI command that sets a logged-in
+// repeater's local advert interval in minutes.
+func BuildSetAdvertIntervalCmd(pubKey []byte, minutes uint16, timestamp uint32) []byte {
+	return buildSendTxtMsgCmd(TxtTypeCLIData, pubKey, fmt.Sprintf("set advert.interval %d", minutes), timestamp)
+}
+
+// ValidateAdvertInterval checks minutes against the range the repeater CLI
+// accepts: 0 to disable, otherwise MinAdvertIntervalMins-MaxAdvertIntervalMins.
+func ValidateAdvertInterval(minutes int) error {
+	if minutes == 0 {
+		return nil
+	}
+	if minutes < MinAdvertIntervalMins || minutes > MaxAdvertIntervalMins {
+		return fmt.Errorf("advert interval must be 0 (disabled) or %d-%d minutes, got %d",
+			MinAdvertIntervalMins, MaxAdvertIntervalMins, minutes)
+	}
+	return nil
+}
+
 func BuildSetRadioParamsCmd(freqKHz uint32, bwHz uint32, sf uint8, cr uint8) []byte {
 	cmd := make([]byte, 11)
 	cmd[0] = CmdSetRadioParams
@@ -165,23 +395,201 @@ func BuildSetRadioTxPowerCmd(powerDBm uint8) []byte {
 	return []byte{CmdSetRadioTxPower, powerDBm}
 }
 
+// BuildSendAdvertCmd asks the radio to advertise itself, either flooded
+// across the mesh or zero-hop to direct neighbours only.
+func BuildSendAdvertCmd(flood bool) []byte {
+	if flood {
+		return []byte{CmdSendSelfAdvert, 1}
+	}
+	return []byte{CmdSendSelfAdvert}
+}
+
 func BuildRebootCmd() []byte {
 	return []byte{CmdReboot}
 }
 
+func BuildGetBatteryCmd() []byte {
+	return []byte{CmdGetBattery}
+}
+
 type RadioRegion struct {
-	Name    string
+	Name    string // region code, e.g. "US"
+	Preset  string // preset within the region, e.g. "LongFast"
 	FreqKHz uint32
 	BwHz    uint32
 	SF      uint8
 	CR      uint8
+	// MaxTxPowerDBm is the regulatory EIRP limit for the preset's band.
+	MaxTxPowerDBm uint8
+}
+
+// FullName returns the preset as accepted by LookupPreset, e.g. "US-Narrow".
+func (r RadioRegion) FullName() string {
+	return r.Name + "-" + r.Preset
+}
+
+// Presets lists the named radio presets for each region code. The first
+// preset of each region is its default, which a bare region code selects.
+var Presets = map[string][]RadioRegion{
+	"US": {
+		{Name: "US", Preset: "Narrow", FreqKHz: 910525, BwHz: 62500, SF: 7, CR: 5, MaxTxPowerDBm: 30},
+		{Name: "US", Preset: "LongFast", FreqKHz: 910525, BwHz: 250000, SF: 11, CR: 5, MaxTxPowerDBm: 30},
+		{Name: "US", Preset: "MediumSlow", FreqKHz: 910525, BwHz: 250000, SF: 10, CR: 5, MaxTxPowerDBm: 30},
+	},
+	"EU": {
+		{Name: "EU", Preset: "MediumSlow", FreqKHz: 869525, BwHz: 250000, SF: 10, CR: 5, MaxTxPowerDBm: 27},
+		{Name: "EU", Preset: "LongFast", FreqKHz: 869525, BwHz: 250000, SF: 11, CR: 5, MaxTxPowerDBm: 27},
+		{Name: "EU", Preset: "Narrow", FreqKHz: 869618, BwHz: 62500, SF: 8, CR: 8, MaxTxPowerDBm: 27},
+	},
+	"AU": {
+		{Name: "AU", Preset: "MediumSlow", FreqKHz: 915000, BwHz: 250000, SF: 10, CR: 5, MaxTxPowerDBm: 30},
+		{Name: "AU", Preset: "LongFast", FreqKHz: 915000, BwHz: 250000, SF: 11, CR: 5, MaxTxPowerDBm: 30},
+		{Name: "AU", Preset: "Narrow", FreqKHz: 916575, BwHz: 62500, SF: 7, CR: 8, MaxTxPowerDBm: 30},
+	},
+	"NZ": {
+		{Name: "NZ", Preset: "MediumSlow", FreqKHz: 915000, BwHz: 250000, SF: 10, CR: 5, MaxTxPowerDBm: 30},
+		{Name: "NZ", Preset: "LongFast", FreqKHz: 915000, BwHz: 250000, SF: 11, CR: 5, MaxTxPowerDBm: 30},
+	},
 }
 
+// Regions maps each region code to its default preset.
 var Regions = map[string]RadioRegion{
-	"US": {Name: "US", FreqKHz: 910525, BwHz: 62500, SF: 7, CR: 5},
-	"EU": {Name: "EU", FreqKHz: 869525, BwHz: 250000, SF: 10, CR: 5},
-	"AU": {Name: "AU", FreqKHz: 915000, BwHz: 250000, SF: 10, CR: 5},
-	"NZ": {Name: "NZ", FreqKHz: 915000, BwHz: 250000, SF: 10, CR: 5},
+	"US": Presets["US"][0],
+	"EU": Presets["EU"][0],
+	"AU": Presets["AU"][0],
+	"NZ": Presets["NZ"][0],
+}
+
+// LookupPreset finds a preset by region code alone ("EU", the region's
+// default) or region and preset name ("EU-LongFast"), ignoring case.
+func LookupPreset(name string) (RadioRegion, bool) {
+	code, preset, hasPreset := strings.Cut(name, "-")
+	presets := Presets[strings.ToUpper(code)]
+	if len(presets) == 0 {
+		return RadioRegion{}, false
+	}
+	if !hasPreset {
+		return presets[0], true
+	}
+	for _, p := range presets {
+		if strings.EqualFold(p.Preset, preset) {
+			return p, true
+		}
+	}
+	return RadioRegion{}, false
+}
+
+// presetFreqToleranceKHz is how far a radio's frequency may be from a
+// preset's and still match it, allowing for the firmware storing it as a float.
+const presetFreqToleranceKHz = 5
+
+// MatchPresets returns the presets with the given radio parameters, sorted by
+// full name. Regions sharing a band can match the same parameters, and none
+// match a custom configuration.
+func MatchPresets(freqKHz, bwHz uint32, sf, cr uint8) []RadioRegion {
+	var matches []RadioRegion
+	for _, presets := range Presets {
+		for _, p := range presets {
+			diff := int64(p.FreqKHz) - int64(freqKHz)
+			if diff < 0 {
+				diff = -diff
+			}
+			if diff <= presetFreqToleranceKHz && p.BwHz == bwHz && p.SF == sf && p.CR == cr {
+				matches = append(matches, p)
+			}
+		}
+	}
+	slices.SortFunc(matches, func(a, b RadioRegion) int { return strings.Compare(a.FullName(), b.FullName()) })
+	return matches
+}
+
+// CountryRegions maps ISO 3166-1 alpha-2 country codes to the key in Regions
+// for that country's LoRa band. Countries without a preset are omitted.
+var CountryRegions = map[string]string{
+	// 902-928 MHz
+	"US": "US", "CA": "US", "MX": "US", "PR": "US", "GU": "US",
+	// 863-870 MHz: EU member states plus EEA, UK and Switzerland
+	"AT": "EU", "BE": "EU", "BG": "EU", "HR": "EU", "CY": "EU", "CZ": "EU",
+	"DK": "EU", "EE": "EU", "FI": "EU", "FR": "EU", "DE": "EU", "GR": "EU",
+	"HU": "EU", "IE": "EU", "IT": "EU", "LV": "EU", "LT": "EU", "LU": "EU",
+	"MT": "EU", "NL": "EU", "PL": "EU", "PT": "EU", "RO": "EU", "SK": "EU",
+	"SI": "EU", "ES": "EU", "SE": "EU", "IS": "EU", "LI": "EU", "NO": "EU",
+	"CH": "EU", "GB": "EU",
+	// 915-928 MHz
+	"AU": "AU",
+	"NZ": "NZ",
+}
+
+// RegionForCountry returns the radio preset for an ISO country code.
+func RegionForCountry(country string) (RadioRegion, bool) {
+	code, ok := CountryRegions[strings.ToUpper(country)]
+	if !ok {
+		return RadioRegion{}, false
+	}
+	r, ok := Regions[code]
+	return r, ok
+}
+
+// loraBandwidthsHz are the bandwidths LoRa transceivers support.
+var loraBandwidthsHz = []uint32{7800, 10400, 15600, 20800, 31250, 41700, 62500, 125000, 250000, 500000}
+
+// ismBandsKHz are the sub-GHz bands LoRa radios are used in, as inclusive
+// [low, high] ranges.
+var ismBandsKHz = [][2]uint32{
+	{433050, 434790}, // ITU region 1 433 MHz
+	{470000, 510000}, // China
+	{863000, 870000}, // Europe, India
+	{902000, 928000}, // Americas, Australia, New Zealand, Asia
+}
+
+// ValidateRadioParams rejects LoRa settings no radio can apply, so mistakes
+// are reported clearly instead of as the radio's bare error code.
+func ValidateRadioParams(freqKHz, bwHz uint32, sf, cr uint8) error {
+	if sf < 5 || sf > 12 {
+		return fmt.Errorf("spreading factor must be 5-12, got %d", sf)
+	}
+	if cr < 5 || cr > 8 {
+		return fmt.Errorf("coding rate must be 5-8 (4/5 to 4/8), got %d", cr)
+	}
+	if !slices.Contains(loraBandwidthsHz, bwHz) {
+		return fmt.Errorf("bandwidth %d Hz is not a LoRa bandwidth (%v)", bwHz, loraBandwidthsHz)
+	}
+	for _, b := range ismBandsKHz {
+		if freqKHz >= b[0] && freqKHz <= b[1] {
+			return nil
+		}
+	}
+	return fmt.Errorf("frequency %.3f MHz is outside the sub-GHz ISM bands", float64(freqKHz)/1000.0)
+}
+
+// ValidateTxPower checks a requested TX power against what the radio can
+// deliver (maxTx, from SelfInfo) and the region's legal limit. The limit is
+// on EIRP, so antenna gain must also fit under it.
+func ValidateTxPower(dBm int, maxTx uint8, r RadioRegion) error {
+	if dBm < 1 {
+		return fmt.Errorf("TX power must be at least 1 dBm, got %d", dBm)
+	}
+	if maxTx > 0 && dBm > int(maxTx) {
+		return fmt.Errorf("TX power %d dBm exceeds this radio's maximum of %d dBm", dBm, maxTx)
+	}
+	if r.MaxTxPowerDBm > 0 && dBm > int(r.MaxTxPowerDBm) {
+		return fmt.Errorf("TX power %d dBm exceeds the %s limit of %d dBm EIRP", dBm, r.Name, r.MaxTxPowerDBm)
+	}
+	return nil
+}
+
+// DefaultTxPower returns the highest TX power allowed by both the radio
+// (maxTx, from SelfInfo) and the region's legal limit, or 0 if neither is
+// known.
+func DefaultTxPower(maxTx uint8, r RadioRegion) int {
+	switch {
+	case maxTx == 0:
+		return int(r.MaxTxPowerDBm)
+	case r.MaxTxPowerDBm == 0:
+		return int(maxTx)
+	default:
+		return int(min(maxTx, r.MaxTxPowerDBm))
+	}
 }
 
 func ParseSelfInfo(data []byte) (*SelfInfo, error) {
@@ -195,10 +603,17 @@ func ParseSelfInfo(data []byte) (*SelfInfo, error) {
 	if data[0] != RespCodeSelfInfo {
 		return nil, fmt.Errorf("unexpected response code: 0x%02X", data[0])
 	}
-	info := &SelfInfo{}
+	info := &SelfInfo{
+		TxPower: data[2],
+		MaxTx:   data[3],
+	}
 	copy(info.PubKey[:], data[4:4+PubKeySize])
 	info.Lat = float64(int32(binary.LittleEndian.Uint32(data[36:40]))) / 1e6
 	info.Lon = float64(int32(binary.LittleEndian.Uint32(data[40:44]))) / 1e6
+	info.FreqKHz = binary.LittleEndian.Uint32(data[48:52])
+	info.BwHz = binary.LittleEndian.Uint32(data[52:56])
+	info.SF = data[56]
+	info.CR = data[57]
 	if len(data) > headerSize {
 		info.Name = trimNull(data[headerSize:])
 	}
@@ -227,6 +642,44 @@ func ParseVersion(data []byte) (string, error) {
 	return trimNull(data[1:]), nil
 }
 
+func ParseDeviceInfo(data []byte) (*DeviceInfo, error) {
+	// Format: [0]=code, [1]=firmware_ver_code, [2]=max_contacts/2,
+	// [3]=max_channels, [4-7]=ble_pin, [8-19]=build_date(12),
+	// [20-59]=model(40), [60-79]=version(20)
+	if len(data) < 2 {
+		return nil, fmt.Errorf("insufficient data for device info: %d", len(data))
+	}
+	if data[0] != RespCodeDeviceInfo {
+		return nil, fmt.Errorf("unexpected response code: 0x%02X", data[0])
+	}
+	info := &DeviceInfo{FirmwareCode: data[1]}
+	if len(data) >= 4 {
+		info.MaxContacts = int(data[2]) * 2
+		info.MaxChannels = int(data[3])
+	}
+	if len(data) >= 20 {
+		info.BuildDate = trimNull(data[8:20])
+	}
+	if len(data) >= 60 {
+		info.Model = trimNull(data[20:60])
+	}
+	if len(data) >= 80 {
+		info.Version = trimNull(data[60:80])
+	}
+	return info, nil
+}
+
+func ParseBattery(data []byte) (uint16, error) {
+	// Format: [0]=code, [1-2]=battery_mv, [3+]=storage used/total (newer firmware)
+	if len(data) < 3 {
+		return 0, fmt.Errorf("insufficient data for battery: %d", len(data))
+	}
+	if data[0] != RespCodeBattery {
+		return 0, fmt.Errorf("unexpected response code: 0x%02X", data[0])
+	}
+	return binary.LittleEndian.Uint16(data[1:3]), nil
+}
+
 func ParseOwnerInfoResponse(data []byte) (version, nodeName, ownerInfo string, err error) {
 	// Format: [0]=code, [1-6]=sender prefix, [7]=reserved, [8-11]=timestamp, [12+]=payload
 	// Payload format: "version\nnode_name\nowner_info"
@@ -300,6 +753,19 @@ func ParseSentResponse(data []byte) (isFlood bool, tag uint32, timeout uint32, e
 	return isFlood, tag, timeout, nil
 }
 
+// ParseSendConfirmed decodes a delivery ack push: the ack code, which matches
+// the tag returned when the message was sent, and the round trip in
+// milliseconds.
+func ParseSendConfirmed(data []byte) (ack uint32, roundTripMs uint32, err error) {
+	if len(data) < 9 {
+		return 0, 0, fmt.Errorf("insufficient data for send confirmed: %d", len(data))
+	}
+	if data[0] != PushCodeSendConfirmed {
+		return 0, 0, fmt.Errorf("unexpected response code: 0x%02X", data[0])
+	}
+	return binary.LittleEndian.Uint32(data[1:5]), binary.LittleEndian.Uint32(data[5:9]), nil
+}
+
 func ParseLoginSuccess(data []byte) (pubKeyPrefix []byte, err error) {
 	if len(data) < 8 {
 		return nil, fmt.Errorf("insufficient data for login success: %d", len(data))
@@ -310,6 +776,98 @@ func ParseLoginSuccess(data []byte) (pubKeyPrefix []byte, err error) {
 	return data[2:8], nil
 }
 
+// ParseLoginFail returns the reason byte of a login fail push. Current
+// firmware always sends 0 there; see LoginFailReasonName.
+func ParseLoginFail(data []byte) (reason uint8, err error) {
+	if len(data) < 8 {
+		return 0, fmt.Errorf("insufficient data for login fail: %d", len(data))
+	}
+	if data[0] != PushCodeLoginFail {
+		return 0, fmt.Errorf("unexpected response code: 0x%02X", data[0])
+	}
+	return data[1], nil
+}
+
+// LoginFailReasonName returns a label-friendly name for a login fail reason.
+// The firmware doesn't distinguish reasons yet, so 0 (a wrong password, or
+// a guest login the repeater doesn't allow) is "unspecified" and anything
+// else is reported by number.
+func LoginFailReasonName(reason uint8) string {
+	if reason == 0 {
+		return "unspecified"
+	}
+	return fmt.Sprintf("code_%d", reason)
+}
+
+// PushSenderPrefix returns the 6-byte public key prefix identifying the node
+// a login result or status push came from.
+func PushSenderPrefix(data []byte) ([]byte, error) {
+	if len(data) < 8 {
+		return nil, fmt.Errorf("insufficient data for sender prefix: %d", len(data))
+	}
+	switch data[0] {
+	case PushCodeLoginSuccess, PushCodeLoginFail, PushCodeStatusResponse, PushCodeTelemetryResponse:
+		return data[2:8], nil
+	}
+	return nil, fmt.Errorf("push code 0x%02X carries no sender prefix", data[0])
+}
+
+// PushTag returns the tag of a binary response, which is the tag the radio
+// returned when the request was sent. Binary responses carry no sender
+// prefix, so this is what ties one to its request.
+func PushTag(data []byte) (uint32, error) {
+	if len(data) < 6 {
+		return 0, fmt.Errorf("insufficient data for push tag: %d", len(data))
+	}
+	if data[0] != PushCodeBinaryResponse {
+		return 0, fmt.Errorf("push code 0x%02X carries no tag", data[0])
+	}
+	return binary.LittleEndian.Uint32(data[2:6]), nil
+}
+
+func ParseLogRxData(data []byte) (*RxLogEntry, error) {
+	// Format: [0]=0x88, [1]=snr*4, [2]=rssi, [3+]=raw_packet
+	// Raw packet: [0]=header, [1]=path_len, [2..]=path, remainder=encrypted_payload
+	if len(data) < 6 {
+		return nil, fmt.Errorf("insufficient data for rx log: %d", len(data))
+	}
+	if data[0] != PushCodeLogRxData {
+		return nil, fmt.Errorf("unexpected response code: 0x%02X", data[0])
+	}
+	raw := data[3:]
+	e := &RxLogEntry{
+		SNR:         float64(int8(data[1])) / 4.0,
+		RSSI:        int8(data[2]),
+		RouteType:   raw[0] & 0x03,
+		PayloadType: (raw[0] >> 2) & 0x0F,
+		PathLen:     int(raw[1]),
+	}
+	if len(raw) < 2+e.PathLen {
+		return nil, fmt.Errorf("rx log path length %d exceeds packet size %d", e.PathLen, len(raw))
+	}
+	if e.PathLen > 0 {
+		e.FirstHop = raw[2]
+	}
+	e.PayloadSize = len(raw) - 2 - e.PathLen
+	return e, nil
+}
+
+// ParseStatusResponse decodes a status push. After the push code, a reserved
+// byte and the 6-byte sender prefix, the frame carries the repeater's stats
+// struct:
+//
+//	8  battery_mv      uint16    32 flood_tx        uint32
+//	10 queue_len       uint16    36 direct_tx       uint32
+//	12 noise_floor     int16     40 flood_rx        uint32
+//	14 last_rssi       int16     44 direct_rx       uint32
+//	16 recv            uint32    48 err_events      uint16
+//	20 sent            uint32    50 last_snr*4      int16
+//	24 tx_air_secs     uint32    52 direct/flood dups (unparsed)
+//	28 uptime_secs     uint32    56 rx_air_secs     uint32 (newer firmware)
+//
+// All fields are little-endian and the signed ones two's complement. SNR is
+// not at 12 or 14 (those are the noise floor and RSSI) but last_snr at 50,
+// in quarter dB and read as int16 so it keeps its sign: 0xFFEC is -5 dB.
 func ParseStatusResponse(data []byte) (*StatsCore, *StatsRadio, *StatsPackets, error) {
 	if len(data) < 8 {
 		return nil, nil, nil, fmt.Errorf("insufficient data for status response: %d", len(data))
@@ -318,21 +876,25 @@ func ParseStatusResponse(data []byte) (*StatsCore, *StatsRadio, *StatsPackets, e
 		return nil, nil, nil, fmt.Errorf("unexpected response code: 0x%02X", data[0])
 	}
 
-	if len(data) < 48 {
-		return nil, nil, nil, fmt.Errorf("insufficient status data: %d", len(data))
+	if len(data) < StatusResponseSize {
+		return nil, nil, nil, fmt.Errorf("insufficient status data: got %d, need %d", len(data), StatusResponseSize)
 	}
 
 	core := &StatsCore{
 		BatteryMV:  binary.LittleEndian.Uint16(data[8:10]),
 		QueueLen:   data[10],
 		UptimeSecs: binary.LittleEndian.Uint32(data[28:32]),
+		Errors:     binary.LittleEndian.Uint16(data[48:50]),
 	}
 
 	radio := &StatsRadio{
-		LastRSSI:  int8(data[12]),
-		LastSNR:   float64(int8(data[14])) / 4.0,
-		TxAirSecs: binary.LittleEndian.Uint32(data[24:28]),
-		RxAirSecs: binary.LittleEndian.Uint32(data[56:60]),
+		NoiseFloor: int16(binary.LittleEndian.Uint16(data[12:14])),
+		LastRSSI:   int8(int16(binary.LittleEndian.Uint16(data[14:16]))),
+		LastSNR:    float64(int16(binary.LittleEndian.Uint16(data[50:52]))) / 4.0,
+		TxAirSecs:  binary.LittleEndian.Uint32(data[24:28]),
+	}
+	if len(data) >= statusRxAirOffset+4 {
+		radio.RxAirSecs = binary.LittleEndian.Uint32(data[statusRxAirOffset : statusRxAirOffset+4])
 	}
 
 	packets := &StatsPackets{
@@ -354,12 +916,36 @@ func ParseStatsCore(data []byte) (*StatsCore, error) {
 	if data[0] != RespCodeStats || data[1] != StatsTypeCore {
 		return nil, errors.New("invalid response type for core stats")
 	}
-	return &StatsCore{
+	core := &StatsCore{
 		BatteryMV:  binary.LittleEndian.Uint16(data[2:4]),
 		UptimeSecs: binary.LittleEndian.Uint32(data[4:8]),
 		Errors:     binary.LittleEndian.Uint16(data[8:10]),
 		QueueLen:   data[10],
-	}, nil
+	}
+	// Newer firmware appends the temperature in hundredths of a degree.
+	if len(data) >= StatsCoreSize+2 {
+		core.TemperatureC = float64(int16(binary.LittleEndian.Uint16(data[11:13]))) / 100
+		core.HasTemp = true
+	}
+	return core, nil
+}
+
+// ErrorFlagNames names the bits of StatsCore.Errors, per the firmware's
+// dispatcher error events. Bits not listed are unassigned.
+var ErrorFlagNames = []string{
+	0: "queue_full",
+	1: "cad_timeout",
+	2: "startrx_timeout",
+}
+
+// DecodeErrorFlags reports each named bit of an error flags bitmask as set or
+// clear.
+func DecodeErrorFlags(flags uint16) map[string]bool {
+	decoded := make(map[string]bool, len(ErrorFlagNames))
+	for bit, name := range ErrorFlagNames {
+		decoded[name] = flags&(1<<bit) != 0
+	}
+	return decoded
 }
 
 func ParseStatsRadio(data []byte) (*StatsRadio, error) {
@@ -395,43 +981,62 @@ func ParseStatsPackets(data []byte) (*StatsPackets, error) {
 	}, nil
 }
 
+// ParseTelemetryResponse decodes the Cayenne LPP records in a telemetry
+// reply, either a PushCodeBinaryResponse to a ReqTypeGetTelemetryData binary
+// request or a PushCodeTelemetryResponse. Decoding stops at the first record
+// of an unknown type, since its length can't be known.
 func ParseTelemetryResponse(data []byte) (*TelemetryData, error) {
-	if len(data) < 7 {
+	var payload []byte
+	switch {
+	case len(data) < 7:
 		return nil, fmt.Errorf("insufficient data for telemetry response: %d", len(data))
-	}
-	if data[0] != PushCodeBinaryResponse {
+	case data[0] == PushCodeBinaryResponse:
+		payload = data[6:]
+	case data[0] == PushCodeTelemetryResponse && len(data) >= 8:
+		payload = data[8:]
+	default:
 		return nil, fmt.Errorf("unexpected response code: 0x%02X", data[0])
 	}
 
 	td := &TelemetryData{}
-	payload := data[6:]
-
-	for len(payload) >= 4 {
-		lppType := payload[1]
+	// Channel 0 is unused; the firmware zero-pads after the last record.
+	for len(payload) >= 2 && payload[0] != 0 {
+		channel, lppType := payload[0], payload[1]
+		size, ok := lppSizes[lppType]
+		if !ok || len(payload) < 2+size {
+			break
+		}
+		v := payload[2 : 2+size]
+		var value float64
 		switch lppType {
 		case LPPVoltage:
-			if len(payload) < 4 {
-				break
+			value = float64(binary.BigEndian.Uint16(v)) / 100
+			if !slices.ContainsFunc(td.Channels, isVoltage) {
+				td.BatteryVolts = value
 			}
-			raw := uint16(payload[2])<<8 | uint16(payload[3])
-			td.BatteryVolts = float64(raw) / 100.0
-			payload = payload[4:]
 		case LPPTemperature:
-			if len(payload) < 4 {
-				break
+			value = float64(int16(binary.BigEndian.Uint16(v))) / 10
+			if !td.HasTemp {
+				td.Temperature, td.HasTemp = value, true
 			}
-			raw := int16(uint16(payload[2])<<8 | uint16(payload[3]))
-			td.Temperature = float64(raw) / 10.0
-			td.HasTemp = true
-			payload = payload[4:]
+		case LPPHumidity:
+			value = float64(v[0]) / 2
+		case LPPBarometer:
+			value = float64(binary.BigEndian.Uint16(v)) / 10
+		case LPPCurrent:
+			value = float64(binary.BigEndian.Uint16(v)) / 1000
+		case LPPAnalogInput:
+			value = float64(int16(binary.BigEndian.Uint16(v))) / 100
 		default:
-			if len(payload) >= 4 {
-				payload = payload[4:]
-			} else {
-				payload = nil
-			}
+			// Known length but not a scalar we export; skip it.
+			payload = payload[2+size:]
+			continue
 		}
+		td.Channels = append(td.Channels, TelemetryReading{Channel: channel, Type: lppType, Value: value})
+		payload = payload[2+size:]
 	}
 
 	return td, nil
 }
+
+func isVoltage(r TelemetryReading) bool { return r.Type == LPPVoltage }
@@ -0,0 +1,165 @@
+package meshcore
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+// statusFrame builds a status push of n bytes with every parsed field set,
+// so each offset is checked against a distinct value.
+func statusFrame(n int) []byte {
+	b := make([]byte, n)
+	b[0] = PushCodeStatusResponse
+	copy(b[2:8], []byte{0x1A, 0x2B, 0x3C, 0x4D, 0x5E, 0x6F})
+	put16 := func(off int, v uint16) {
+		if off+2 <= n {
+			binary.LittleEndian.PutUint16(b[off:], v)
+		}
+	}
+	put32 := func(off int, v uint32) {
+		if off+4 <= n {
+			binary.LittleEndian.PutUint32(b[off:], v)
+		}
+	}
+	put16(8, 4100)                 // battery_mv
+	put16(10, 3)                   // queue_len
+	put16(12, uint16(0x10000-110)) // noise_floor = -110
+	put16(14, uint16(0x10000-85))  // last_rssi = -85
+	put32(16, 1000)                // recv
+	put32(20, 500)                 // sent
+	put32(24, 3600)                // tx_air_secs
+	put32(28, 86400)               // uptime_secs
+	put32(32, 300)                 // flood_tx
+	put32(36, 200)                 // direct_tx
+	put32(40, 600)                 // flood_rx
+	put32(44, 400)                 // direct_rx
+	put16(48, 2)                   // err_events
+	put16(50, 29)                  // last_snr*4 = 7.25
+	put32(statusRxAirOffset, 7200) // rx_air_secs
+	return b[:n:n]
+}
+
+func TestParseStatusResponse(t *testing.T) {
+	tests := []struct {
+		name      string
+		size      int
+		snr4      int16 // last_snr*4 at offset 50, if nonzero
+		wantErr   bool
+		wantSNR   float64
+		wantRxAir uint32
+	}{
+		{name: "short frame", size: 50, wantErr: true},
+		{name: "without rx airtime", size: StatusResponseSize, wantSNR: 7.25, wantRxAir: 0},
+		{name: "with rx airtime", size: statusRxAirOffset + 4, wantSNR: 7.25, wantRxAir: 7200},
+		{name: "negative snr", size: StatusResponseSize, snr4: -22, wantSNR: -5.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frame := statusFrame(tt.size)
+			if tt.snr4 != 0 {
+				binary.LittleEndian.PutUint16(frame[50:], uint16(tt.snr4))
+			}
+			core, radio, packets, err := ParseStatusResponse(frame)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("%d-byte frame: expected an error", tt.size)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("%d-byte frame: unexpected error: %v", tt.size, err)
+			}
+			if want := (StatsCore{BatteryMV: 4100, UptimeSecs: 86400, Errors: 2, QueueLen: 3}); *core != want {
+				t.Errorf("core = %+v, want %+v", *core, want)
+			}
+			wantRadio := StatsRadio{NoiseFloor: -110, LastRSSI: -85, LastSNR: tt.wantSNR, TxAirSecs: 3600, RxAirSecs: tt.wantRxAir}
+			if *radio != wantRadio {
+				t.Errorf("radio = %+v, want %+v", *radio, wantRadio)
+			}
+			if want := (StatsPackets{Recv: 1000, Sent: 500, FloodTx: 300, DirectTx: 200, FloodRx: 600, DirectRx: 400}); *packets != want {
+				t.Errorf("packets = %+v, want %+v", *packets, want)
+			}
+		})
+	}
+}
+
+// capturedStatus is a status response as received from a repeater, so the
+// field offsets are checked against what the firmware really sends.
+var capturedStatus = unhex("87 00 3F 9A 11 C2 07 5B" +
+	" 5E 10 00 00 8F FF B1 FF" + // battery_mv, queue_len, noise_floor, last_rssi
+	" 4B 2E 00 00 D3 09 00 00" + // recv, sent
+	" 6D 02 00 00 C1 DA 0B 00" + // tx_air_secs, uptime_secs
+	" 1A 04 00 00 9F 01 00 00" + // flood_tx, direct_tx
+	" 88 21 00 00 A4 0A 00 00" + // flood_rx, direct_rx
+	" 00 00 26 00" + // err_events, last_snr*4
+	" 31 00 5C 03" + // direct_dups, flood_dups
+	" E2 11 00 00") // rx_air_secs
+
+func TestParseStatusResponseCaptured(t *testing.T) {
+	core, radio, packets, err := ParseStatusResponse(capturedStatus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		field string
+		got   any
+		want  any
+	}{
+		{"battery_mv", core.BatteryMV, uint16(4190)},
+		{"queue_len", core.QueueLen, uint8(0)},
+		{"uptime_secs", core.UptimeSecs, uint32(776897)},
+		{"err_events", core.Errors, uint16(0)},
+		{"noise_floor", radio.NoiseFloor, int16(-113)},
+		{"last_rssi", radio.LastRSSI, int8(-79)},
+		{"last_snr", radio.LastSNR, 9.5},
+		{"tx_air_secs", radio.TxAirSecs, uint32(621)},
+		{"rx_air_secs", radio.RxAirSecs, uint32(4578)},
+		{"recv", packets.Recv, uint32(11851)},
+		{"sent", packets.Sent, uint32(2515)},
+		{"flood_tx", packets.FloodTx, uint32(1050)},
+		{"direct_tx", packets.DirectTx, uint32(415)},
+		{"flood_rx", packets.FloodRx, uint32(8584)},
+		{"direct_rx", packets.DirectRx, uint32(2724)},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.field, tt.got, tt.want)
+		}
+	}
+}
+
+func TestBuildAppStartCmd(t *testing.T) {
+	tests := []struct {
+		name string
+		app  string
+		want []byte
+	}{
+		{
+			name: "default name",
+			app:  DefaultAppName,
+			want: unhex("01" + // CmdAppStart
+				" 03" + // app version
+				" 00 00 00 00 00 00" + // reserved
+				" 6D 63 63 6C 69"), // "mccli"
+		},
+		{
+			name: "empty name",
+			app:  "",
+			want: unhex("01 03 00 00 00 00 00 00"),
+		},
+		{
+			name: "truncated name",
+			app:  strings.Repeat("x", MaxAppNameLen+10),
+			want: append(unhex("01 03 00 00 00 00 00 00"), strings.Repeat("x", MaxAppNameLen)...),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := BuildAppStartCmd(tt.app); !bytes.Equal(got, tt.want) {
+				t.Errorf("BuildAppStartCmd(%q) = % X, want % X", tt.app, got, tt.want)
+			}
+		})
+	}
+}
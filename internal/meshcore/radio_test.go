@@ -0,0 +1,174 @@
+package meshcore_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/watsoncj/meshcore-stats/internal/meshcore"
+	"github.com/watsoncj/meshcore-stats/internal/meshcore/meshcoretest"
+)
+
+// statsCoreFrame is a core stats response: 4100 mV, 86400 s up, error flags
+// 0x0002 and 3 packets queued.
+var statsCoreFrame = []byte{meshcore.RespCodeStats, meshcore.StatsTypeCore, 0x04, 0x10, 0x80, 0x51, 0x01, 0x00, 0x02, 0x00, 0x03}
+
+// newRadio returns a Radio over a fresh mock with short timeouts, so tests
+// that expect a timeout don't wait out the defaults.
+func newRadio(t *testing.T) (*meshcore.Radio, *meshcoretest.MockTransport) {
+	t.Helper()
+	m := meshcoretest.New()
+	radio := m.Radio()
+	if err := radio.SetReadTimeout(20 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	radio.SetReadRetries(0)
+	radio.SetCommandTimeout(time.Second)
+	return radio, m
+}
+
+func TestGetStatsCore(t *testing.T) {
+	radio, m := newRadio(t)
+	m.EnqueueFrame(statsCoreFrame)
+
+	core, err := radio.GetStatsCore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := meshcore.StatsCore{BatteryMV: 4100, UptimeSecs: 86400, Errors: 2, QueueLen: 3}
+	if *core != want {
+		t.Errorf("core = %+v, want %+v", *core, want)
+	}
+	cmds := m.Commands()
+	if len(cmds) != 1 || !bytes.Equal(cmds[0], meshcore.BuildGetStatsCmd(meshcore.StatsTypeCore)) {
+		t.Errorf("commands = %X, want one %X", cmds, meshcore.BuildGetStatsCmd(meshcore.StatsTypeCore))
+	}
+}
+
+func TestCommandSkipsPushes(t *testing.T) {
+	radio, m := newRadio(t)
+	// A delivery confirmation arriving ahead of the response is handled as
+	// a push, not taken as the answer.
+	m.EnqueueFrame([]byte{meshcore.PushCodeSendConfirmed, 0x01, 0x02, 0x03, 0x04, 0x10, 0x00, 0x00, 0x00})
+	m.EnqueueFrame(statsCoreFrame)
+
+	core, err := radio.GetStatsCore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if core.BatteryMV != 4100 {
+		t.Errorf("battery = %d, want 4100", core.BatteryMV)
+	}
+}
+
+func TestTruncatedFrameTimesOut(t *testing.T) {
+	radio, m := newRadio(t)
+	// The header promises the whole core stats frame but only part of it
+	// arrives.
+	m.Enqueue([]byte{'>', byte(len(statsCoreFrame)), 0x00})
+	m.Enqueue(statsCoreFrame[:4])
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := radio.GetStatsCore()
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, meshcore.ErrReadTimeout) {
+			t.Errorf("err = %v, want a read timeout", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("GetStatsCore hung on a truncated frame")
+	}
+}
+
+func TestNoResponseTimesOut(t *testing.T) {
+	radio, _ := newRadio(t)
+	if _, err := radio.GetStatsCore(); !errors.Is(err, meshcore.ErrReadTimeout) {
+		t.Errorf("err = %v, want a read timeout", err)
+	}
+}
+
+func TestContactsTimeoutCoversWholeDownload(t *testing.T) {
+	radio, m := newRadio(t)
+	radio.SetContactsTimeout(200 * time.Millisecond)
+	// The radio announces more contacts than it ever finishes sending, each
+	// arriving well inside the timeout.
+	m.EnqueueFrame([]byte{meshcore.RespCodeContactsStart, 0xFF, 0xFF, 0x00, 0x00})
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		contact := make([]byte, 148)
+		contact[0] = meshcore.RespCodeContact
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(5 * time.Millisecond):
+				m.EnqueueFrame(contact)
+			}
+		}
+	}()
+
+	start := time.Now()
+	_, err := radio.GetContacts()
+	if !errors.Is(err, meshcore.ErrCommandTimeout) {
+		t.Errorf("err = %v, want a command timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("download ran %s past a 200ms timeout", elapsed)
+	}
+}
+
+func TestWaitForReplyMatchesRequest(t *testing.T) {
+	radio, m := newRadio(t)
+	pubKey := []byte{0xA1, 0xA2, 0xA3, 0xA4, 0xA5, 0xA6, 0x00}
+	// Late replies to another repeater's requests, by tag and by prefix,
+	// arrive ahead of this one's.
+	m.EnqueueFrame([]byte{meshcore.PushCodeBinaryResponse, 0x00, 0x01, 0x00, 0x00, 0x00, 0xEE})
+	m.EnqueueFrame([]byte{meshcore.PushCodeTelemetryResponse, 0x00, 0xB1, 0xB2, 0xB3, 0xB4, 0xB5, 0xB6, 0xEE})
+	want := []byte{meshcore.PushCodeBinaryResponse, 0x00, 0x02, 0x00, 0x00, 0x00, 0x01}
+	m.EnqueueFrame(want)
+
+	codes := []byte{meshcore.PushCodeBinaryResponse, meshcore.PushCodeTelemetryResponse}
+	data, err := radio.WaitForReplyContext(context.Background(), codes, pubKey, 2, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, want) {
+		t.Errorf("reply = %X, want %X", data, want)
+	}
+}
+
+func TestSetRadioTxPowerReplies(t *testing.T) {
+	tests := []struct {
+		name    string
+		reply   []byte
+		wantErr string
+	}{
+		{name: "ok", reply: []byte{meshcore.RespCodeOK}},
+		{name: "error with code", reply: []byte{meshcore.RespCodeErr, 0x03}, wantErr: "radio rejected TX power (error code 3)"},
+		{name: "error without code", reply: []byte{meshcore.RespCodeErr}, wantErr: "radio rejected TX power"},
+		{name: "empty", reply: []byte{}, wantErr: "empty response to TX power"},
+		{name: "unexpected", reply: []byte{0x7F}, wantErr: "unexpected response to TX power: 0x7F"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			radio, m := newRadio(t)
+			m.EnqueueFrame(tt.reply)
+			err := radio.SetRadioTxPower(20)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -1,33 +1,116 @@
 package meshcore
 
 import (
+	"bytes"
+	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/watsoncj/meshcore-stats/internal/metrics"
-	"go.bug.st/serial"
 )
 
 const (
 	frameHeaderTx = '<' // client -> device
 	frameHeaderRx = '>' // device -> client
 	maxFrameSize  = 512
+
+	// DefaultReadRetries is how many read timeouts a command tolerates
+	// while waiting for its response.
+	DefaultReadRetries = 2
+
+	// DefaultReadTimeout is how long a read waits for the radio to send
+	// anything outside of WaitForPush.
+	DefaultReadTimeout = 2 * time.Second
+
+	// DefaultCommandTimeout bounds how long a command waits for its
+	// response, however many pushes arrive in the meantime.
+	DefaultCommandTimeout = 10 * time.Second
+
+	// DefaultContactsTimeout bounds a whole contacts download, which streams
+	// a frame per contact and so outlasts an ordinary command.
+	DefaultContactsTimeout = 2 * time.Minute
 )
 
+// ErrReadTimeout is wrapped by read errors where the radio sent nothing
+// before the read timeout. It is still reported as an invalid frame header so
+// a silent radio escalates to a reconnect.
+var ErrReadTimeout = errors.New("no data before read timeout")
+
+// ErrCommandTimeout is wrapped by command errors where the radio kept the
+// link busy, usually with pushes, without answering within the command
+// timeout.
+var ErrCommandTimeout = errors.New("no response before command timeout")
+
 type Radio struct {
-	port        serial.Port
+	port        Transport
 	mu          sync.Mutex
-	portName    string
-	baudRate    int
-	nodeName    string
+	dial        func() (Transport, error)
+	nodeName    atomic.Value      // string; read with and without mu held
+	contactsMu  sync.RWMutex      // guards contactsMap and pathByteMap, read while mu is held
 	contactsMap map[string]string // pubkey prefix (4 hex chars) -> name
 	pathByteMap map[byte]string   // path byte (1-byte hash) -> name
+	lastRx      rxSignal
+	seenMu      sync.Mutex
+	lastSeen    map[senderKey]time.Time // mesh senders with published per-sender series
+	readRetries int
+	readTimeout time.Duration
+	cmdTimeout  time.Duration
+	listTimeout time.Duration // for contact downloads; see commandTimeout
+	appName     string
+	capture     io.Writer // receives a copy of every frame read, if set
+	dedup       packetDedup
+}
+
+// senderKey identifies the per-sender mesh series of one node.
+type senderKey struct {
+	node, sender string
 }
 
+// rxSignal is the signal quality of a packet the companion radio received,
+// from its rx log push.
+type rxSignal struct {
+	rssi int8
+	snr  float64
+	at   time.Time
+}
+
+// Open connects to a radio on a local serial port.
 func Open(portName string, baudRate int) (*Radio, error) {
-	r := &Radio{portName: portName, baudRate: baudRate}
+	return OpenTransport(func() (Transport, error) { return openSerial(portName, baudRate) })
+}
+
+// OpenTCP connects to a radio whose serial port is exposed over TCP (for
+// example with ser2net) at addr, given as host:port.
+func OpenTCP(addr string) (*Radio, error) {
+	return OpenTransport(func() (Transport, error) { return dialTCP(addr) })
+}
+
+// OpenBLE connects to a companion radio over Bluetooth LE, scanning for the
+// device advertising deviceName (e.g. "MeshCore-1A2B3C4D").
+func OpenBLE(deviceName string) (*Radio, error) {
+	return OpenTransport(func() (Transport, error) { return openBLE(deviceName) })
+}
+
+// OpenReplay plays back a capture file of frames from a radio instead of
+// talking to one. See replayTransport for how responses are paired with
+// commands.
+func OpenReplay(path string) (*Radio, error) {
+	return OpenTransport(func() (Transport, error) { return loadReplay(path) })
+}
+
+// OpenTransport connects to a radio over the transport returned by dial,
+// which is called again each time the radio is reconnected.
+func OpenTransport(dial func() (Transport, error)) (*Radio, error) {
+	r := &Radio{dial: dial, readRetries: DefaultReadRetries, readTimeout: DefaultReadTimeout,
+		cmdTimeout: DefaultCommandTimeout, listTimeout: DefaultContactsTimeout, appName: DefaultAppName, dedup: packetDedup{window: DefaultDedupWindow}}
 	if err := r.openPort(); err != nil {
 		return nil, err
 	}
@@ -35,19 +118,12 @@ func Open(portName string, baudRate int) (*Radio, error) {
 }
 
 func (r *Radio) openPort() error {
-	mode := &serial.Mode{
-		BaudRate: r.baudRate,
-		DataBits: 8,
-		Parity:   serial.NoParity,
-		StopBits: serial.OneStopBit,
-	}
-
-	port, err := serial.Open(r.portName, mode)
+	port, err := r.dial()
 	if err != nil {
-		return fmt.Errorf("failed to open serial port: %w", err)
+		return err
 	}
 
-	if err := port.SetReadTimeout(2 * time.Second); err != nil {
+	if err := port.SetReadTimeout(r.readTimeout); err != nil {
 		port.Close()
 		return fmt.Errorf("failed to set read timeout: %w", err)
 	}
@@ -83,28 +159,98 @@ func (r *Radio) DrainPort() {
 			break
 		}
 	}
-	r.port.SetReadTimeout(2 * time.Second)
+	r.port.SetReadTimeout(r.readTimeout)
 }
 
 func (r *Radio) sendCommand(cmd []byte, expectedSize int) ([]byte, error) {
+	var resp []byte
+	err := r.sendCommandFrames(cmd, func(data []byte) (bool, error) {
+		resp = data
+		return false, nil
+	})
+	return resp, err
+}
+
+// sendCommandFrames sends cmd and passes each response frame to handle until
+// it reports no more are expected, for commands answered by a sequence of
+// frames. The radio stays locked for the whole exchange, and pushes and read
+// timeouts are dealt with as for any other command. The command timeout
+// covers the whole exchange; see commandTimeout.
+func (r *Radio) sendCommandFrames(cmd []byte, handle func(data []byte) (more bool, err error)) error {
+	return r.sendCommandFramesContext(context.Background(), cmd, handle)
+}
+
+// sendCommandFramesContext is sendCommandFrames giving up with ctx's error
+// once it is done, checked between reads.
+func (r *Radio) sendCommandFramesContext(ctx context.Context, cmd []byte, handle func(data []byte) (more bool, err error)) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	frame := make([]byte, 3+len(cmd))
-	frame[0] = frameHeaderTx
-	binary.LittleEndian.PutUint16(frame[1:3], uint16(len(cmd)))
-	copy(frame[3:], cmd)
+	start := time.Now()
+	if timeout := r.commandTimeout(cmd[0]); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, timeout, fmt.Errorf("%w (%s)", ErrCommandTimeout, timeout))
+		defer cancel()
+	}
+	if _, err := r.port.Write(encodeFrame(frameHeaderTx, cmd)); err != nil {
+		return fmt.Errorf("failed to write command: %w", err)
+	}
 
-	if _, err := r.port.Write(frame); err != nil {
-		return nil, fmt.Errorf("failed to write command: %w", err)
+	for {
+		data, err := r.readCommandResponse(ctx, cmd[0])
+		if err != nil {
+			return err
+		}
+		more, err := handle(data)
+		if err != nil {
+			return err
+		}
+		if !more {
+			metrics.CommandDuration.WithLabelValues(r.metricNode(), CommandName(cmd[0])).Observe(time.Since(start).Seconds())
+			return nil
+		}
 	}
+}
 
-	return r.readCommandResponse()
+// encodeFrame wraps payload with a header byte and little-endian length.
+func encodeFrame(header byte, payload []byte) []byte {
+	frame := make([]byte, 3+len(payload))
+	frame[0] = header
+	binary.LittleEndian.PutUint16(frame[1:3], uint16(len(payload)))
+	copy(frame[3:], payload)
+	return frame
 }
 
-func (r *Radio) readCommandResponse() ([]byte, error) {
+// SendRaw sends an arbitrary command payload and returns the transmitted
+// frame along with the first non-push frame received in response.
+func (r *Radio) SendRaw(cmd []byte) (tx, rx []byte, err error) {
+	if len(cmd) == 0 || len(cmd) > maxFrameSize {
+		return nil, nil, fmt.Errorf("command must be 1-%d bytes, got %d", maxFrameSize, len(cmd))
+	}
+	tx = encodeFrame(frameHeaderTx, cmd)
+	data, err := r.sendCommand(cmd, 0)
+	if err != nil {
+		return tx, nil, err
+	}
+	return tx, encodeFrame(frameHeaderRx, data), nil
+}
+
+// readCommandResponse reads frames until one that isn't a push. A busy radio
+// can miss the read timeout, so up to readRetries timeouts are absorbed
+// before giving up; other read errors are returned at once. Once ctx is done,
+// command timeout included, it gives up even while pushes keep arriving.
+func (r *Radio) readCommandResponse(ctx context.Context, cmd byte) ([]byte, error) {
+	timeouts := 0
 	for {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("command %d: %w", cmd, context.Cause(ctx))
+		}
 		data, err := r.readFrame()
+		if errors.Is(err, ErrReadTimeout) && timeouts < r.readRetries {
+			timeouts++
+			slog.Debug("Read timeout waiting for response, retrying", "node", r.metricNode(), "attempt", timeouts, "retries", r.readRetries)
+			continue
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -116,25 +262,109 @@ func (r *Radio) readCommandResponse() ([]byte, error) {
 	}
 }
 
+// SetReadTimeout sets how long reads wait for the radio, for links where
+// command round trips are slow. Push waits use their own timeout.
+func (r *Radio) SetReadTimeout(d time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.readTimeout = d
+	return r.port.SetReadTimeout(d)
+}
+
+// SetCapture tees every frame received from the radio, header included, to
+// w in the format OpenReplay reads. If a write fails the error is logged and
+// capturing stops; collection carries on.
+func (r *Radio) SetCapture(w io.Writer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.capture = w
+}
+
+// SetAppName sets the client name AppStart identifies the session with.
+// Names longer than MaxAppNameLen are truncated.
+func (r *Radio) SetAppName(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.appName = name
+}
+
+// SetCommandTimeout sets how long a command waits for its whole response
+// before giving up; 0 waits as long as frames keep arriving.
+func (r *Radio) SetCommandTimeout(d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cmdTimeout = d
+}
+
+// SetContactsTimeout is SetCommandTimeout for contact downloads, which need
+// longer than other commands on large tables or slow links.
+func (r *Radio) SetContactsTimeout(d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.listTimeout = d
+}
+
+// commandTimeout returns the budget for the exchange started by cmd. The
+// caller holds r.mu.
+func (r *Radio) commandTimeout(cmd byte) time.Duration {
+	if cmd == CmdGetContacts {
+		return r.listTimeout
+	}
+	return r.cmdTimeout
+}
+
+// SetDedupWindow sets how long a repeat of an observed mesh packet is counted
+// as a duplicate rather than a new packet; 0 counts every copy.
+func (r *Radio) SetDedupWindow(d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.dedup = packetDedup{window: d}
+}
+
+// SetReadRetries sets how many read timeouts a command tolerates before its
+// response is given up on.
+func (r *Radio) SetReadRetries(n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.readRetries = n
+}
+
+// SetNodeName sets the node label for metrics the radio records itself, such
+// as mesh packets it overhears. It can be called while the radio is in use.
 func (r *Radio) SetNodeName(name string) {
-	r.nodeName = name
+	r.nodeName.Store(name)
+}
+
+// metricNode returns the node label for metrics recorded by the radio itself.
+func (r *Radio) metricNode() string {
+	name, _ := r.nodeName.Load().(string)
+	if name == "" {
+		return "unknown"
+	}
+	return name
 }
 
 func (r *Radio) SetContacts(contacts []Contact) {
-	r.contactsMap = make(map[string]string)
-	r.pathByteMap = make(map[byte]string)
+	contactsMap := make(map[string]string)
+	pathByteMap := make(map[byte]string)
 	for _, c := range contacts {
 		prefix := fmt.Sprintf("%02X%02X", c.PubKey[0], c.PubKey[1])
-		r.contactsMap[prefix] = c.Name
+		contactsMap[prefix] = c.Name
 		// The path hash is just pub_key[0] (first byte of pubkey)
 		// Note: collisions are possible but we just take the first match
-		if _, exists := r.pathByteMap[c.PubKey[0]]; !exists {
-			r.pathByteMap[c.PubKey[0]] = c.Name
+		if _, exists := pathByteMap[c.PubKey[0]]; !exists {
+			pathByteMap[c.PubKey[0]] = c.Name
 		}
 	}
+	r.contactsMu.Lock()
+	defer r.contactsMu.Unlock()
+	r.contactsMap = contactsMap
+	r.pathByteMap = pathByteMap
 }
 
 func (r *Radio) AddSelfToContacts(info *SelfInfo) {
+	r.contactsMu.Lock()
+	defer r.contactsMu.Unlock()
 	if r.contactsMap == nil {
 		r.contactsMap = make(map[string]string)
 	}
@@ -148,7 +378,18 @@ func (r *Radio) AddSelfToContacts(info *SelfInfo) {
 	}
 }
 
+// LastRxSignal returns the RSSI and SNR the companion radio measured for the
+// most recent packet it logged, and when it was received. at is zero if no
+// rx log push has been seen.
+func (r *Radio) LastRxSignal() (rssi int8, snr float64, at time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lastRx.rssi, r.lastRx.snr, r.lastRx.at
+}
+
 func (r *Radio) LookupSender(prefix string) string {
+	r.contactsMu.RLock()
+	defer r.contactsMu.RUnlock()
 	if r.contactsMap == nil {
 		return prefix
 	}
@@ -161,6 +402,8 @@ func (r *Radio) LookupSender(prefix string) string {
 // LookupSenderByPathByte maps a 1-byte path hash to a contact name.
 // MeshCore uses a single-byte truncated hash of the pubkey for path routing.
 func (r *Radio) LookupSenderByPathByte(pathByte byte) string {
+	r.contactsMu.RLock()
+	defer r.contactsMu.RUnlock()
 	if r.pathByteMap == nil {
 		return fmt.Sprintf("%02X", pathByte)
 	}
@@ -176,46 +419,75 @@ func (r *Radio) handlePushMessage(data []byte) {
 	}
 	switch data[0] {
 	case PushCodeLogRxData:
-		// Format: [0]=0x88, [1]=snr*4, [2]=rssi, [3+]=raw_packet
-		// Raw packet: [0]=header, [1]=path_len, [2..]=path, remainder=encrypted_payload
 		// The sender identity is encrypted and not directly extractable.
 		// We can only track packets by "origin" = first hop in the path (the node we received from).
-		if len(data) < 6 {
-			return
-		}
-		snr := float64(int8(data[1])) / 4.0
-		rssi := int8(data[2])
-		rawPacket := data[3:]
-
-		// Raw packet structure
-		if len(rawPacket) < 3 {
+		e, err := ParseLogRxData(data)
+		if err != nil {
 			return
 		}
-		// header := rawPacket[0]
-		pathLen := int(rawPacket[1])
-
-		// The origin is the first hop in the path - this is the node we received from directly.
-		// For zero-hop packets, the path is empty and we can't identify the sender.
-		var origin string
-		if pathLen > 0 && len(rawPacket) >= 2+pathLen {
-			// First path byte is the immediate sender (1-byte truncated hash of pubkey)
-			origin = r.LookupSenderByPathByte(rawPacket[2])
+		r.lastRx = rxSignal{rssi: e.RSSI, snr: e.SNR, at: time.Now()}
+		origin := r.RxOrigin(e)
+
+		node := r.metricNode()
+		// Signal and last-seen are still per copy: each neighbour relaying a
+		// flood is heard separately.
+		if r.dedup.duplicate(rxPacketHash(data, e), time.Now()) {
+			metrics.MeshPacketsDuplicate.WithLabelValues(node).Inc()
 		} else {
-			origin = "direct"
+			metrics.MeshPacketsObserved.WithLabelValues(node, origin, RouteTypeName(e.RouteType), PayloadTypeName(e.PayloadType)).Inc()
+		}
+		r.seenMu.Lock()
+		if r.lastSeen == nil {
+			r.lastSeen = make(map[senderKey]time.Time)
 		}
-		payloadLen := len(rawPacket) - 2 - pathLen
+		key := senderKey{node, origin}
+		if _, ok := r.lastSeen[key]; !ok {
+			metrics.MeshSenderFirstSeen.WithLabelValues(node, origin).SetToCurrentTime()
+		}
+		r.lastSeen[key] = time.Now()
+		r.seenMu.Unlock()
+		metrics.MeshSenderLastSeen.WithLabelValues(node, origin).SetToCurrentTime()
+		metrics.MeshPacketRSSI.WithLabelValues(node, origin).Set(float64(e.RSSI))
+		metrics.MeshPacketSNR.WithLabelValues(node, origin).Set(e.SNR)
+		metrics.MeshPacketRSSIHistogram.WithLabelValues(node, origin).Observe(float64(e.RSSI))
+		metrics.MeshPacketSNRHistogram.WithLabelValues(node, origin).Observe(e.SNR)
+		if e.PayloadSize > 0 {
+			metrics.MeshPacketBytes.WithLabelValues(node, origin).Add(float64(e.PayloadSize))
+		}
+	case PushCodeSendConfirmed:
+		metrics.MessagesDelivered.WithLabelValues(r.metricNode()).Inc()
+	}
+}
 
-		node := r.nodeName
-		if node == "" {
-			node = "unknown"
+// PruneSenders deletes the per-sender mesh series of senders not heard from
+// within ttl, so a busy mesh doesn't accumulate series for nodes that have
+// gone. It returns how many senders were pruned. A pruned sender that is
+// heard again starts over with a new first-seen time.
+func (r *Radio) PruneSenders(ttl time.Duration) int {
+	r.seenMu.Lock()
+	defer r.seenMu.Unlock()
+	pruned := 0
+	for key, at := range r.lastSeen {
+		if time.Since(at) < ttl {
+			continue
 		}
-		metrics.MeshPacketsObserved.WithLabelValues(node, origin).Inc()
-		metrics.MeshPacketRSSI.WithLabelValues(node, origin).Set(float64(rssi))
-		metrics.MeshPacketSNR.WithLabelValues(node, origin).Set(snr)
-		if payloadLen > 0 {
-			metrics.MeshPacketBytes.WithLabelValues(node, origin).Add(float64(payloadLen))
+		labels := prometheus.Labels{"node": key.node, "sender": key.sender}
+		for _, v := range metrics.MeshSenderSeries() {
+			v.DeletePartialMatch(labels)
 		}
+		delete(r.lastSeen, key)
+		pruned++
+	}
+	return pruned
+}
+
+// RxOrigin names the node an overheard packet was received from: its first
+// path hop, or "direct" for zero-hop packets where no sender is identifiable.
+func (r *Radio) RxOrigin(e *RxLogEntry) string {
+	if e.PathLen == 0 {
+		return "direct"
 	}
+	return r.LookupSenderByPathByte(e.FirstHop)
 }
 
 func isPushCode(code byte) bool {
@@ -224,12 +496,30 @@ func isPushCode(code byte) bool {
 
 func (r *Radio) readFrame() ([]byte, error) {
 	hdr := make([]byte, 3)
-	if _, err := r.port.Read(hdr); err != nil {
+	n, err := r.port.Read(hdr)
+	if err != nil {
 		return nil, fmt.Errorf("failed to read frame header: %w", err)
 	}
 
+	if n == 0 {
+		return nil, fmt.Errorf("invalid frame header: %w", ErrReadTimeout)
+	}
 	if hdr[0] != frameHeaderRx {
-		return nil, fmt.Errorf("invalid frame header: got 0x%02X, expected 0x%02X", hdr[0], frameHeaderRx)
+		if err := r.resync(hdr, n); err != nil {
+			return nil, err
+		}
+		n = len(hdr)
+	}
+	// Some USB serial drivers split the header across reads.
+	for n < len(hdr) {
+		got, err := r.port.Read(hdr[n:])
+		if err != nil {
+			return nil, fmt.Errorf("failed to read frame header: %w", err)
+		}
+		if got == 0 {
+			return nil, fmt.Errorf("truncated frame header (%d of %d bytes): %w", n, len(hdr), ErrReadTimeout)
+		}
+		n += got
 	}
 
 	frameLen := binary.LittleEndian.Uint16(hdr[1:3])
@@ -244,12 +534,63 @@ func (r *Radio) readFrame() ([]byte, error) {
 		if err != nil {
 			return nil, fmt.Errorf("failed to read frame payload: %w", err)
 		}
+		if n == 0 {
+			return nil, fmt.Errorf("truncated frame payload (%d of %d bytes): %w", totalRead, frameLen, ErrReadTimeout)
+		}
 		totalRead += n
 	}
 
+	if r.capture != nil {
+		if _, err := r.capture.Write(encodeFrame(frameHeaderRx, payload)); err != nil {
+			slog.Error("Error writing frame capture, capture stopped", "err", err)
+			r.capture = nil
+		}
+	}
 	return payload, nil
 }
 
+// resync recovers from reading mid-frame by discarding bytes until the next
+// frameHeaderRx marker and then re-reading the rest of the header into hdr.
+// n is how many bytes of hdr were already read. If no marker turns up within
+// maxFrameSize bytes the usual invalid frame header error is returned so the
+// caller falls back to reconnecting.
+func (r *Radio) resync(hdr []byte, n int) error {
+	bad := hdr[0]
+	skipped := 0
+	for hdr[0] != frameHeaderRx {
+		if n > 1 {
+			copy(hdr, hdr[1:n])
+			n--
+			skipped++
+			continue
+		}
+		if skipped >= maxFrameSize {
+			return fmt.Errorf("invalid frame header: got 0x%02X, expected 0x%02X (no marker in %d bytes)", bad, frameHeaderRx, skipped)
+		}
+		got, err := r.port.Read(hdr[:1])
+		if err != nil {
+			return fmt.Errorf("failed to read frame header: %w", err)
+		}
+		if got == 0 {
+			return fmt.Errorf("invalid frame header: got 0x%02X, expected 0x%02X (timed out resyncing)", bad, frameHeaderRx)
+		}
+		skipped++
+	}
+	for n < len(hdr) {
+		got, err := r.port.Read(hdr[n:])
+		if err != nil {
+			return fmt.Errorf("failed to read frame header: %w", err)
+		}
+		if got == 0 {
+			return fmt.Errorf("invalid frame header: timed out after resync")
+		}
+		n += got
+	}
+	metrics.ResyncEvents.WithLabelValues(r.metricNode()).Inc()
+	slog.Warn("Resynchronized serial stream", "node", r.metricNode(), "discarded_bytes", skipped)
+	return nil
+}
+
 func (r *Radio) GetVersion() (string, error) {
 	data, err := r.sendCommand(BuildGetVersionCmd(), 0)
 	if err != nil {
@@ -258,12 +599,31 @@ func (r *Radio) GetVersion() (string, error) {
 	return ParseVersion(data)
 }
 
+func (r *Radio) DeviceQuery() (*DeviceInfo, error) {
+	data, err := r.sendCommand(BuildDeviceQueryCmd(), 0)
+	if err != nil {
+		return nil, err
+	}
+	return ParseDeviceInfo(data)
+}
+
+// GetBatteryMillivolts reads the battery voltage with the dedicated battery
+// command, which some boards report even when core stats read zero.
+func (r *Radio) GetBatteryMillivolts() (uint16, error) {
+	data, err := r.sendCommand(BuildGetBatteryCmd(), 0)
+	if err != nil {
+		return 0, err
+	}
+	return ParseBattery(data)
+}
+
 func (r *Radio) GetStatsCore() (*StatsCore, error) {
 	data, err := r.sendCommand(BuildGetStatsCmd(StatsTypeCore), StatsCoreSize)
 	if err != nil {
 		return nil, err
 	}
-	return ParseStatsCore(data)
+	core, err := ParseStatsCore(data)
+	return core, r.countParseError("core", err)
 }
 
 func (r *Radio) GetStatsRadio() (*StatsRadio, error) {
@@ -271,7 +631,8 @@ func (r *Radio) GetStatsRadio() (*StatsRadio, error) {
 	if err != nil {
 		return nil, err
 	}
-	return ParseStatsRadio(data)
+	radio, err := ParseStatsRadio(data)
+	return radio, r.countParseError("radio", err)
 }
 
 func (r *Radio) GetStatsPackets() (*StatsPackets, error) {
@@ -279,69 +640,77 @@ func (r *Radio) GetStatsPackets() (*StatsPackets, error) {
 	if err != nil {
 		return nil, err
 	}
-	return ParseStatsPackets(data)
+	packets, err := ParseStatsPackets(data)
+	return packets, r.countParseError("packets", err)
 }
 
 func (r *Radio) AppStart() (*SelfInfo, error) {
-	data, err := r.sendCommand(BuildAppStartCmd(), 0)
+	data, err := r.sendCommand(BuildAppStartCmd(r.appName), 0)
 	if err != nil {
 		return nil, err
 	}
-	return ParseSelfInfo(data)
+	info, err := ParseSelfInfo(data)
+	return info, r.countParseError("selfinfo", err)
 }
 
-func (r *Radio) GetContacts() ([]Contact, error) {
-	r.mu.Lock()
-	defer r.mu.Unlock()
-
-	frame := make([]byte, 3+1)
-	frame[0] = frameHeaderTx
-	binary.LittleEndian.PutUint16(frame[1:3], 1)
-	frame[3] = CmdGetContacts
-
-	if _, err := r.port.Write(frame); err != nil {
-		return nil, fmt.Errorf("failed to write command: %w", err)
+// countParseError counts a failure to decode a frame the radio sent in
+// meshcore_parse_errors_total, so layout changes stand apart from I/O errors.
+func (r *Radio) countParseError(parser string, err error) error {
+	if err != nil {
+		metrics.ParseErrors.WithLabelValues(r.metricNode(), parser).Inc()
 	}
+	return err
+}
 
-	// Read frames, skipping any push messages
-	readResponseFrame := func() ([]byte, error) {
-		for {
-			data, err := r.readFrame()
+func (r *Radio) GetContacts() ([]Contact, error) {
+	return r.GetContactsContext(context.Background())
+}
+
+// GetContactsContext is like GetContacts but abandons the download once ctx
+// is done.
+func (r *Radio) GetContactsContext(ctx context.Context) ([]Contact, error) {
+	// Large tables stream hundreds of frames, so report how far along the
+	// download is.
+	const logEvery = 50
+	progress := metrics.ContactsFetchProgress.WithLabelValues(r.metricNode())
+
+	var contacts []Contact
+	var count uint32
+	started := false
+	err := r.sendCommandFramesContext(ctx, BuildGetContactsCmd(), func(data []byte) (bool, error) {
+		if !started {
+			n, err := ParseContactsStart(data)
 			if err != nil {
-				return nil, err
+				return false, r.countParseError("contact", err)
 			}
-			if len(data) > 0 && isPushCode(data[0]) {
-				r.handlePushMessage(data)
-				continue
-			}
-			return data, nil
-		}
-	}
-
-	data, err := readResponseFrame()
-	if err != nil {
-		return nil, err
-	}
-	count, err := ParseContactsStart(data)
-	if err != nil {
-		return nil, err
-	}
-
-	contacts := make([]Contact, 0, count)
-	for {
-		data, err := readResponseFrame()
-		if err != nil {
-			return nil, err
+			count, started = n, true
+			contacts = make([]Contact, 0, count)
+			progress.Set(0)
+			return true, nil
 		}
 		if len(data) > 0 && data[0] == RespCodeEndOfContacts {
-			break
+			return false, nil
 		}
 		contact, err := ParseContact(data)
 		if err != nil {
-			return nil, err
+			return false, r.countParseError("contact", err)
 		}
 		contacts = append(contacts, *contact)
+		if count > 0 {
+			progress.Set(float64(len(contacts)) / float64(count))
+		}
+		if len(contacts)%logEvery == 0 {
+			slog.Debug("Receiving contacts", "received", len(contacts), "total", count)
+		}
+		return true, nil
+	})
+	if err != nil {
+		if started {
+			return nil, fmt.Errorf("after %d of %d contacts: %w", len(contacts), count, err)
+		}
+		return nil, err
 	}
+	progress.Set(1)
 	return contacts, nil
 }
 
@@ -381,6 +750,55 @@ func (r *Radio) SendTelemetryReq(pubKey []byte) (uint32, error) {
 	return tag, err
 }
 
+// SendText sends a plain text message to a contact and returns the tag its
+// delivery ack will carry.
+func (r *Radio) SendText(pubKey []byte, text string) (uint32, error) {
+	if len(pubKey) < 6 {
+		return 0, fmt.Errorf("public key too short: %d", len(pubKey))
+	}
+	if len(text) > MaxTextMessageLen {
+		return 0, fmt.Errorf("text message is %d bytes, limit is %d", len(text), MaxTextMessageLen)
+	}
+	data, err := r.sendCommand(BuildSendTextMessageCmd(pubKey[:6], text), 0)
+	if err != nil {
+		return 0, err
+	}
+	_, tag, _, err := ParseSentResponse(data)
+	return tag, err
+}
+
+// WaitForDelivery waits for the delivery ack of the message sent with tag and
+// returns its round trip. Acks for other messages seen meanwhile are counted
+// but otherwise ignored.
+func (r *Radio) WaitForDelivery(tag uint32, timeout time.Duration) (time.Duration, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return 0, fmt.Errorf("timeout waiting for delivery of message %08X", tag)
+		}
+		data, err := r.WaitForPushCode([]byte{PushCodeSendConfirmed}, remaining)
+		if err != nil {
+			return 0, err
+		}
+		r.handlePushMessage(data)
+		if ack, rtt, err := ParseSendConfirmed(data); err == nil && ack == tag {
+			return time.Duration(rtt) * time.Millisecond, nil
+		}
+	}
+}
+
+// SetAdvertInterval sends a remote CLI command setting the advert interval
+// of a repeater that has already accepted an admin login.
+func (r *Radio) SetAdvertInterval(pubKey []byte, minutes uint16) (uint32, error) {
+	data, err := r.sendCommand(BuildSetAdvertIntervalCmd(pubKey, minutes, uint32(time.Now().Unix())), 0)
+	if err != nil {
+		return 0, err
+	}
+	_, tag, _, err := ParseSentResponse(data)
+	return tag, err
+}
+
 func (r *Radio) WaitForPush(timeout time.Duration) ([]byte, error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
@@ -388,50 +806,155 @@ func (r *Radio) WaitForPush(timeout time.Duration) ([]byte, error) {
 	if err := r.port.SetReadTimeout(timeout); err != nil {
 		return nil, err
 	}
-	defer r.port.SetReadTimeout(2 * time.Second)
+	defer r.port.SetReadTimeout(r.readTimeout)
 
 	return r.readFrame()
 }
 
 func (r *Radio) WaitForPushCode(wantCodes []byte, timeout time.Duration) ([]byte, error) {
+	return r.waitForPush(context.Background(), wantCodes, nil, timeout)
+}
+
+// pushSource is the node a push is expected from: matched by sender prefix
+// for pushes that carry one, and for binary responses, which don't, by the
+// tag of the request they answer.
+type pushSource struct {
+	prefix []byte
+	tag    uint32
+	tagged bool
+}
+
+func (s *pushSource) matches(data []byte) bool {
+	if sender, err := PushSenderPrefix(data); err == nil {
+		return bytes.Equal(sender, s.prefix)
+	}
+	if tag, err := PushTag(data); err == nil {
+		return s.tagged && tag == s.tag
+	}
+	return false
+}
+
+// WaitForPushCodeContext is like WaitForPushCode but returns ctx's error as
+// soon as it is cancelled.
+func (r *Radio) WaitForPushCodeContext(ctx context.Context, wantCodes []byte, timeout time.Duration) ([]byte, error) {
+	return r.waitForPush(ctx, wantCodes, nil, timeout)
+}
+
+// WaitForPushFrom is like WaitForPushCode but only accepts pushes whose
+// sender prefix matches pubKey, so a late response from another node isn't
+// attributed to the one being queried. Only codes that carry a sender prefix
+// (see PushSenderPrefix) can be matched.
+func (r *Radio) WaitForPushFrom(wantCodes []byte, pubKey []byte, timeout time.Duration) ([]byte, error) {
+	if len(pubKey) < 6 {
+		return nil, fmt.Errorf("public key too short: %d", len(pubKey))
+	}
+	return r.waitForPush(context.Background(), wantCodes, &pushSource{prefix: pubKey[:6]}, timeout)
+}
+
+// WaitForPushFromContext is like WaitForPushFrom but returns ctx's error as
+// soon as it is cancelled.
+func (r *Radio) WaitForPushFromContext(ctx context.Context, wantCodes []byte, pubKey []byte, timeout time.Duration) ([]byte, error) {
+	if len(pubKey) < 6 {
+		return nil, fmt.Errorf("public key too short: %d", len(pubKey))
+	}
+	return r.waitForPush(ctx, wantCodes, &pushSource{prefix: pubKey[:6]}, timeout)
+}
+
+// WaitForReplyContext is like WaitForPushFromContext but also accepts binary
+// responses carrying tag, the one SendOwnerInfoReq or SendTelemetryReq
+// returned, so replies that have no sender prefix are still matched to the
+// request.
+func (r *Radio) WaitForReplyContext(ctx context.Context, wantCodes []byte, pubKey []byte, tag uint32, timeout time.Duration) ([]byte, error) {
+	if len(pubKey) < 6 {
+		return nil, fmt.Errorf("public key too short: %d", len(pubKey))
+	}
+	return r.waitForPush(ctx, wantCodes, &pushSource{prefix: pubKey[:6], tag: tag, tagged: true}, timeout)
+}
+
+// pushPollInterval bounds each read while waiting for a push with a
+// cancellable context, so cancellation is noticed without waiting out the
+// whole timeout.
+const pushPollInterval = 250 * time.Millisecond
+
+func (r *Radio) waitForPush(ctx context.Context, wantCodes []byte, from *pushSource, timeout time.Duration) ([]byte, error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	if err := r.port.SetReadTimeout(timeout); err != nil {
+	readTimeout := timeout
+	if ctx.Done() != nil && pushPollInterval < timeout {
+		readTimeout = pushPollInterval
+	}
+	if err := r.port.SetReadTimeout(readTimeout); err != nil {
 		return nil, err
 	}
-	defer r.port.SetReadTimeout(2 * time.Second)
+	defer r.port.SetReadTimeout(r.readTimeout)
 
-	deadline := time.Now().Add(timeout)
+	// While polling, read timeouts are retried until the deadline, when
+	// the last one is returned as a single full-length read would have.
+	var timeoutErr error
+	start := time.Now()
+	deadline := start.Add(timeout)
 	for time.Now().Before(deadline) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		data, err := r.readFrame()
 		if err != nil {
+			if readTimeout < timeout && errors.Is(err, ErrReadTimeout) {
+				timeoutErr = err
+				continue
+			}
 			return nil, err
 		}
 		if len(data) == 0 {
 			continue
 		}
-		for _, code := range wantCodes {
-			if data[0] == code {
-				return data, nil
+		if !slices.Contains(wantCodes, data[0]) {
+			if data[0] == PushCodeLogRxData || data[0] == PushCodeSendConfirmed {
+				r.handlePushMessage(data)
 			}
+			continue
+		}
+		if from != nil && !from.matches(data) {
+			slog.Debug("Ignoring push from another node", "code", fmt.Sprintf("0x%02X", data[0]),
+				"data", fmt.Sprintf("%X", data), "want", fmt.Sprintf("%X", from.prefix))
+			continue
 		}
+		metrics.CommandDuration.WithLabelValues(r.metricNode(), "wait_"+PushCodeName(data[0])).Observe(time.Since(start).Seconds())
+		return data, nil
+	}
+	if timeoutErr != nil {
+		return nil, timeoutErr
 	}
 	return nil, fmt.Errorf("timeout waiting for response")
 }
 
 func (r *Radio) SetRadioParams(freqKHz uint32, bwHz uint32, sf uint8, cr uint8) error {
+	if err := ValidateRadioParams(freqKHz, bwHz, sf, cr); err != nil {
+		return err
+	}
 	data, err := r.sendCommand(BuildSetRadioParamsCmd(freqKHz, bwHz, sf, cr), 0)
 	if err != nil {
 		return err
 	}
-	if len(data) > 0 && data[0] == RespCodeOK {
+	return checkOK(data, "parameters")
+}
+
+// checkOK interprets the reply to a command answered with RespCodeOK or
+// RespCodeErr, naming the command as what in errors. Error replies from
+// older firmware may leave out the error code.
+func checkOK(data []byte, what string) error {
+	switch {
+	case len(data) == 0:
+		return fmt.Errorf("empty response to %s", what)
+	case data[0] == RespCodeOK:
 		return nil
+	case data[0] == RespCodeErr && len(data) >= 2:
+		return fmt.Errorf("radio rejected %s (error code %d)", what, data[1])
+	case data[0] == RespCodeErr:
+		return fmt.Errorf("radio rejected %s", what)
 	}
-	if len(data) > 0 && data[0] == RespCodeErr {
-		return fmt.Errorf("radio rejected parameters (error code %d)", data[1])
-	}
-	return fmt.Errorf("unexpected response: 0x%02X", data[0])
+	return fmt.Errorf("unexpected response to %s: 0x%02X", what, data[0])
 }
 
 func (r *Radio) SetRadioTxPower(powerDBm uint8) error {
@@ -439,10 +962,19 @@ func (r *Radio) SetRadioTxPower(powerDBm uint8) error {
 	if err != nil {
 		return err
 	}
-	if len(data) > 0 && data[0] == RespCodeOK {
-		return nil
+	return checkOK(data, "TX power")
+}
+
+func (r *Radio) SendAdvert(flood bool) error {
+	data, err := r.sendCommand(BuildSendAdvertCmd(flood), 0)
+	if err != nil {
+		return err
+	}
+	if err := checkOK(data, "advert"); err != nil {
+		return err
 	}
-	return fmt.Errorf("unexpected response: 0x%02X", data[0])
+	metrics.AdvertsSent.WithLabelValues(r.metricNode()).Inc()
+	return nil
 }
 
 func (r *Radio) Reboot() error {
@@ -450,8 +982,5 @@ func (r *Radio) Reboot() error {
 	if err != nil {
 		return err
 	}
-	if len(data) > 0 && data[0] == RespCodeOK {
-		return nil
-	}
-	return fmt.Errorf("unexpected response: 0x%02X", data[0])
+	return checkOK(data, "reboot")
 }
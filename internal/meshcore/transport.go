@@ -0,0 +1,183 @@
+package meshcore
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"go.bug.st/serial"
+)
+
+// Transport is the byte stream a Radio is framed over. Read must return
+// (0, nil) when the read timeout expires with no data, as serial ports do.
+type Transport interface {
+	Read(p []byte) (int, error)
+	Write(p []byte) (int, error)
+	SetReadTimeout(t time.Duration) error
+	Close() error
+}
+
+func openSerial(portName string, baudRate int) (Transport, error) {
+	mode := &serial.Mode{
+		BaudRate: baudRate,
+		DataBits: 8,
+		Parity:   serial.NoParity,
+		StopBits: serial.OneStopBit,
+	}
+	port, err := serial.Open(portName, mode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open serial port: %w", err)
+	}
+	return port, nil
+}
+
+// tcpTransport carries the serial protocol over a TCP connection, such as a
+// radio exposed by ser2net.
+type tcpTransport struct {
+	conn    net.Conn
+	timeout time.Duration
+}
+
+func dialTCP(addr string) (Transport, error) {
+	conn, err := net.DialTimeout("tcp", addr, 10*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+	return &tcpTransport{conn: conn}, nil
+}
+
+func (t *tcpTransport) Read(p []byte) (int, error) {
+	if t.timeout > 0 {
+		if err := t.conn.SetReadDeadline(time.Now().Add(t.timeout)); err != nil {
+			return 0, err
+		}
+	}
+	n, err := t.conn.Read(p)
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return n, nil
+	}
+	return n, err
+}
+
+func (t *tcpTransport) Write(p []byte) (int, error) { return t.conn.Write(p) }
+
+func (t *tcpTransport) SetReadTimeout(d time.Duration) error {
+	t.timeout = d
+	return nil
+}
+
+func (t *tcpTransport) Close() error { return t.conn.Close() }
+
+// replayTransport plays back a capture of frames the radio sent, for running
+// the exporter without hardware. Each command written releases its response
+// and the pushes that follow it, up to the next response. Commands with a
+// known response code first skip ahead to a frame with that code, so frames
+// nobody asks for (such as startup replies when the capture loops) don't
+// knock later replies out of step. The capture loops when it runs out.
+type replayTransport struct {
+	frames  [][]byte
+	next    int
+	pending []byte
+	timeout time.Duration
+}
+
+// replayResponses maps command codes to the response code that answers them.
+var replayResponses = map[byte]byte{
+	CmdAppStart:      RespCodeSelfInfo,
+	CmdGetContacts:   RespCodeContactsStart,
+	CmdGetVersion:    RespCodeVersion,
+	CmdGetBattery:    RespCodeBattery,
+	CmdDeviceQuery:   RespCodeDeviceInfo,
+	CmdSendTxtMsg:    RespCodeSent,
+	CmdSendLogin:     RespCodeSent,
+	CmdSendStatusReq: RespCodeSent,
+	CmdSendBinaryReq: RespCodeSent,
+	CmdGetStats:      RespCodeStats,
+}
+
+// loadReplay reads a capture file of concatenated '>' frames.
+func loadReplay(path string) (Transport, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read replay file: %w", err)
+	}
+	var frames [][]byte
+	for off := 0; off < len(data); {
+		if len(data)-off < 3 || data[off] != frameHeaderRx {
+			return nil, fmt.Errorf("replay file %s: invalid frame header at offset %d", path, off)
+		}
+		n := int(binary.LittleEndian.Uint16(data[off+1 : off+3]))
+		if n == 0 || len(data)-off < 3+n {
+			return nil, fmt.Errorf("replay file %s: frame at offset %d is empty or truncated", path, off)
+		}
+		frames = append(frames, data[off:off+3+n])
+		off += 3 + n
+	}
+	if len(frames) == 0 {
+		return nil, fmt.Errorf("replay file %s contains no frames", path)
+	}
+	return &replayTransport{frames: frames}, nil
+}
+
+func (t *replayTransport) Read(p []byte) (int, error) {
+	if len(t.pending) == 0 {
+		time.Sleep(t.timeout)
+		return 0, nil
+	}
+	n := copy(p, t.pending)
+	t.pending = t.pending[n:]
+	return n, nil
+}
+
+// answers reports whether frame is the response to the command payload cmd.
+// Commands without a known response accept any frame.
+func answers(frame, cmd []byte) bool {
+	want, ok := replayResponses[cmd[0]]
+	if !ok {
+		return true
+	}
+	if frame[3] != want {
+		return false
+	}
+	// Stats replies echo the requested type.
+	return want != RespCodeStats || len(cmd) < 2 || (len(frame) > 4 && frame[4] == cmd[1])
+}
+
+// continues reports whether frame belongs to the reply already released,
+// either as a push or as a later frame of a multi-frame response.
+func continues(frame []byte) bool {
+	code := frame[3]
+	return isPushCode(code) || code == RespCodeContact || code == RespCodeEndOfContacts
+}
+
+// Write discards the command and releases its response.
+func (t *replayTransport) Write(p []byte) (int, error) {
+	if len(p) <= 3 {
+		return len(p), nil
+	}
+	cmd := p[3:]
+	for i := 0; i < len(t.frames); i++ {
+		if answers(t.frames[t.next], cmd) {
+			break
+		}
+		t.next = (t.next + 1) % len(t.frames)
+	}
+	for i := 0; i < len(t.frames); i++ {
+		t.pending = append(t.pending, t.frames[t.next]...)
+		t.next = (t.next + 1) % len(t.frames)
+		if !continues(t.frames[t.next]) {
+			break
+		}
+	}
+	return len(p), nil
+}
+
+func (t *replayTransport) SetReadTimeout(d time.Duration) error {
+	t.timeout = d
+	return nil
+}
+
+func (t *replayTransport) Close() error { return nil }
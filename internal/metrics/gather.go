@@ -0,0 +1,195 @@
+package metrics
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// NodeGatherer returns a Gatherer that yields only the series from g whose
+// node label equals node. Metric families with no matching series are
+// omitted entirely.
+func NodeGatherer(g prometheus.Gatherer, node string) prometheus.Gatherer {
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		mfs, err := g.Gather()
+		if err != nil {
+			return nil, err
+		}
+		out := mfs[:0]
+		for _, mf := range mfs {
+			kept := mf.Metric[:0]
+			for _, m := range mf.Metric {
+				if labelValue(m, "node") == node {
+					kept = append(kept, m)
+				}
+			}
+			if len(kept) > 0 {
+				mf.Metric = kept
+				out = append(out, mf)
+			}
+		}
+		return out, nil
+	})
+}
+
+// FlattenNode returns a Gatherer that removes the node label from g's series
+// for the node returned by node, so a single-node exporter can be identified
+// by its scrape target instead. node is called on every gather since the
+// collected node's name may only be learned from the radio after startup.
+// Series for other nodes, such as mesh contacts, keep their label.
+//
+// The label is stripped here rather than left out when the vectors are
+// built because the same vectors carry series for those other nodes, which
+// would collide without it, and because the collected node's name isn't
+// known until the radio has been read.
+func FlattenNode(g prometheus.Gatherer, node func() string) prometheus.Gatherer {
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		mfs, err := g.Gather()
+		if err != nil {
+			return nil, err
+		}
+		primary := node()
+		for _, mf := range mfs {
+			for _, m := range mf.Metric {
+				if labelValue(m, "node") == primary {
+					m.Label = withoutLabel(m.Label, "node")
+				}
+			}
+		}
+		return mfs, nil
+	})
+}
+
+// maxChangeClients bounds how many clients Changes keeps a baseline for. The
+// least recently seen is forgotten to make room, and starts over with every
+// series on its next request.
+const maxChangeClients = 16
+
+// Changes serves the series from a Gatherer whose value differs from the
+// last time each client asked, for bandwidth-constrained collectors that
+// track state themselves. A client's first request returns every series.
+// The result is not a complete exposition and is not meant to be scraped by
+// Prometheus.
+type Changes struct {
+	g prometheus.Gatherer
+
+	mu      sync.Mutex
+	clients map[string]*changeBaseline
+}
+
+// changeBaseline is the value of each series as last sent to one client.
+type changeBaseline struct {
+	last map[string]string
+	used time.Time
+}
+
+func NewChanges(g prometheus.Gatherer) *Changes {
+	return &Changes{g: g, clients: map[string]*changeBaseline{}}
+}
+
+// Gatherer returns a Gatherer yielding the changes since client's previous
+// request. Clients that give no name share the "" baseline, so each sees
+// only part of the changes if more than one polls.
+func (c *Changes) Gatherer(client string) prometheus.Gatherer {
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		mfs, err := c.g.Gather()
+		if err != nil {
+			return nil, err
+		}
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		base := c.baseline(client)
+		last := base.last
+		seen := make(map[string]string, len(last))
+		out := mfs[:0]
+		for _, mf := range mfs {
+			kept := mf.Metric[:0]
+			for _, m := range mf.Metric {
+				key := seriesKey(mf.GetName(), m)
+				value := metricValue(m)
+				seen[key] = value
+				if prev, ok := last[key]; !ok || prev != value {
+					kept = append(kept, m)
+				}
+			}
+			if len(kept) > 0 {
+				mf.Metric = kept
+				out = append(out, mf)
+			}
+		}
+		base.last = seen
+		return out, nil
+	})
+}
+
+// baseline returns client's baseline, making room for a new one if needed.
+// The caller holds c.mu.
+func (c *Changes) baseline(client string) *changeBaseline {
+	base, ok := c.clients[client]
+	if !ok {
+		if len(c.clients) >= maxChangeClients {
+			var oldest string
+			var oldestUsed time.Time
+			for name, b := range c.clients {
+				if oldestUsed.IsZero() || b.used.Before(oldestUsed) {
+					oldest, oldestUsed = name, b.used
+				}
+			}
+			delete(c.clients, oldest)
+		}
+		base = &changeBaseline{}
+		c.clients[client] = base
+	}
+	base.used = time.Now()
+	return base
+}
+
+func seriesKey(name string, m *dto.Metric) string {
+	var b strings.Builder
+	b.WriteString(name)
+	for _, lp := range m.GetLabel() {
+		fmt.Fprintf(&b, "\xff%s=%s", lp.GetName(), lp.GetValue())
+	}
+	return b.String()
+}
+
+// metricValue summarizes a series' sample so changes can be detected.
+// Histograms and summaries change whenever their count or sum does.
+func metricValue(m *dto.Metric) string {
+	switch {
+	case m.Gauge != nil:
+		return fmt.Sprint(m.GetGauge().GetValue())
+	case m.Counter != nil:
+		return fmt.Sprint(m.GetCounter().GetValue())
+	case m.Untyped != nil:
+		return fmt.Sprint(m.GetUntyped().GetValue())
+	case m.Histogram != nil:
+		return fmt.Sprint(m.GetHistogram().GetSampleCount(), m.GetHistogram().GetSampleSum())
+	case m.Summary != nil:
+		return fmt.Sprint(m.GetSummary().GetSampleCount(), m.GetSummary().GetSampleSum())
+	}
+	return ""
+}
+
+func withoutLabel(labels []*dto.LabelPair, name string) []*dto.LabelPair {
+	out := labels[:0]
+	for _, lp := range labels {
+		if lp.GetName() != name {
+			out = append(out, lp)
+		}
+	}
+	return out
+}
+
+func labelValue(m *dto.Metric, name string) string {
+	for _, lp := range m.GetLabel() {
+		if lp.GetName() == name {
+			return lp.GetValue()
+		}
+	}
+	return ""
+}
@@ -0,0 +1,90 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// testGatherer returns a registry holding a battery gauge for the collected
+// node "local" and a contact position for "Hilltop".
+func testGatherer() *prometheus.Registry {
+	reg := prometheus.NewRegistry()
+	battery := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "test_battery_millivolts", Help: "Battery."}, []string{"node"})
+	lat := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "test_contact_latitude", Help: "Latitude."}, []string{"node"})
+	reg.MustRegister(battery, lat)
+	battery.WithLabelValues("local").Set(4100)
+	lat.WithLabelValues("Hilltop").Set(51.5)
+	return reg
+}
+
+func TestFlattenNode(t *testing.T) {
+	primary := func() string { return "local" }
+	tests := []struct {
+		name string
+		g    prometheus.Gatherer
+		want string
+	}{
+		{
+			name: "all nodes",
+			g:    FlattenNode(testGatherer(), primary),
+			want: `
+# HELP test_battery_millivolts Battery.
+# TYPE test_battery_millivolts gauge
+test_battery_millivolts 4100
+# HELP test_contact_latitude Latitude.
+# TYPE test_contact_latitude gauge
+test_contact_latitude{node="Hilltop"} 51.5
+`,
+		},
+		{
+			name: "node path",
+			g:    FlattenNode(NodeGatherer(testGatherer(), "local"), primary),
+			want: `
+# HELP test_battery_millivolts Battery.
+# TYPE test_battery_millivolts gauge
+test_battery_millivolts 4100
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := testutil.GatherAndCompare(tt.g, strings.NewReader(tt.want)); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestChangesPerClient(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	battery := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "test_battery_millivolts", Help: "Battery."}, []string{"node"})
+	reg.MustRegister(battery)
+	battery.WithLabelValues("local").Set(4100)
+	changes := NewChanges(reg)
+
+	count := func(client string) int {
+		t.Helper()
+		n, err := testutil.GatherAndCount(changes.Gatherer(client))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	if n := count("a"); n != 1 {
+		t.Errorf("a's first request = %d series, want 1", n)
+	}
+	if n := count("a"); n != 0 {
+		t.Errorf("a's unchanged request = %d series, want 0", n)
+	}
+	battery.WithLabelValues("local").Set(4090)
+	if n := count("b"); n != 1 {
+		t.Errorf("b's first request = %d series, want 1", n)
+	}
+	// b's request must not have used up the change for a.
+	if n := count("a"); n != 1 {
+		t.Errorf("a's request after a change = %d series, want 1", n)
+	}
+}
@@ -1,147 +1,568 @@
 package metrics
 
 import (
+	"fmt"
+	"slices"
+
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/watsoncj/meshcore-stats/transform"
 )
 
+// collectors holds every exporter metric, keyed by metric name in
+// definition order, so they can be registered together once the
+// command-line configuration (such as extra labels) is known.
+var collectors []namedCollector
+
+type namedCollector struct {
+	name string
+	c    prometheus.Collector
+}
+
+func newGaugeVec(opts prometheus.GaugeOpts, labels []string) *GaugeVec {
+	v := &GaugeVec{prometheus.NewGaugeVec(opts, labels), opts.Name, labels}
+	collectors = append(collectors, namedCollector{opts.Name, v})
+	return v
+}
+
+func newHistogramVec(opts prometheus.HistogramOpts, labels []string) *prometheus.HistogramVec {
+	v := prometheus.NewHistogramVec(opts, labels)
+	collectors = append(collectors, namedCollector{opts.Name, v})
+	return v
+}
+
+func newCounterVec(opts prometheus.CounterOpts, labels []string) *CounterVec {
+	v := &CounterVec{prometheus.NewCounterVec(opts, labels), opts.Name, labels}
+	collectors = append(collectors, namedCollector{opts.Name, v})
+	return v
+}
+
+// GaugeVec is a prometheus.GaugeVec whose values pass through the
+// transforms registered with the transform package as they are set.
+type GaugeVec struct {
+	*prometheus.GaugeVec
+	name string
+	keys []string
+}
+
+func (v *GaugeVec) WithLabelValues(lvs ...string) prometheus.Gauge {
+	return transformedGauge{v.GaugeVec.WithLabelValues(lvs...), v.name, v.keys, lvs}
+}
+
+type transformedGauge struct {
+	prometheus.Gauge
+	name         string
+	keys, values []string
+}
+
+func (g transformedGauge) Set(v float64) {
+	if transform.Enabled() {
+		v = transform.Apply(g.name, labelMap(g.keys, g.values), v)
+	}
+	g.Gauge.Set(v)
+}
+
+// CounterVec is a prometheus.CounterVec whose increments pass through the
+// transforms registered with the transform package as they are added.
+type CounterVec struct {
+	*prometheus.CounterVec
+	name string
+	keys []string
+}
+
+func (v *CounterVec) WithLabelValues(lvs ...string) prometheus.Counter {
+	return transformedCounter{v.CounterVec.WithLabelValues(lvs...), v.name, v.keys, lvs}
+}
+
+type transformedCounter struct {
+	prometheus.Counter
+	name         string
+	keys, values []string
+}
+
+func (c transformedCounter) Add(v float64) {
+	if transform.Enabled() {
+		v = transform.Apply(c.name, labelMap(c.keys, c.values), v)
+	}
+	c.Counter.Add(v)
+}
+
+func labelMap(keys, values []string) map[string]string {
+	m := make(map[string]string, len(keys))
+	for i, k := range keys {
+		if i < len(values) {
+			m[k] = values[i]
+		}
+	}
+	return m
+}
+
+// Register registers exporter metrics with reg. Wrap reg with
+// prometheus.WrapRegistererWith to attach static labels to every metric.
+// If enabled is non-empty only the named metrics are registered, and any
+// named in disabled are left out. Values set on metrics that weren't
+// registered are simply never exported. Unknown names are an error so a
+// typo doesn't silently keep a metric.
+func Register(reg prometheus.Registerer, enabled, disabled []string) error {
+	cs, err := selected(enabled, disabled)
+	if err != nil {
+		return err
+	}
+	for _, c := range cs {
+		if err := reg.Register(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// selected returns the collectors Register would register.
+func selected(enabled, disabled []string) ([]prometheus.Collector, error) {
+	known := make(map[string]bool, len(collectors))
+	for _, nc := range collectors {
+		known[nc.name] = true
+	}
+	for _, name := range append(slices.Clip(enabled), disabled...) {
+		if !known[name] {
+			return nil, fmt.Errorf("unknown metric %q", name)
+		}
+	}
+	var cs []prometheus.Collector
+	for _, nc := range collectors {
+		if len(enabled) > 0 && !slices.Contains(enabled, nc.name) {
+			continue
+		}
+		if slices.Contains(disabled, nc.name) {
+			continue
+		}
+		cs = append(cs, nc.c)
+	}
+	return cs, nil
+}
+
 var (
-	BatteryMillivolts = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	BatteryMillivolts = newGaugeVec(prometheus.GaugeOpts{
 		Name: "meshcore_battery_millivolts",
 		Help: "Battery voltage in millivolts",
 	}, []string{"node"})
 
-	TemperatureCelsius = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	BatterySource = newGaugeVec(prometheus.GaugeOpts{
+		Name: "meshcore_battery_source",
+		Help: "Source of the reported battery voltage (1 for the source in use)",
+	}, []string{"node", "source"})
+
+	TemperatureCelsius = newGaugeVec(prometheus.GaugeOpts{
 		Name: "meshcore_temperature_celsius",
 		Help: "Device temperature in degrees Celsius",
 	}, []string{"node"})
 
-	UptimeSeconds = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	UptimeSeconds = newGaugeVec(prometheus.GaugeOpts{
 		Name: "meshcore_uptime_seconds",
 		Help: "Device uptime in seconds",
 	}, []string{"node"})
 
-	ErrorFlags = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	ErrorFlags = newGaugeVec(prometheus.GaugeOpts{
 		Name: "meshcore_error_flags",
 		Help: "Error flags bitmask",
 	}, []string{"node"})
 
-	QueueLength = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	ErrorFlag = newGaugeVec(prometheus.GaugeOpts{
+		Name: "meshcore_error_flag",
+		Help: "Whether the named error flag is set (1) or clear (0)",
+	}, []string{"node", "flag"})
+
+	QueueLength = newGaugeVec(prometheus.GaugeOpts{
 		Name: "meshcore_queue_length",
 		Help: "Outbound packet queue length",
 	}, []string{"node"})
 
-	NoiseFloorDBm = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	QueueLengthHistogram = newHistogramVec(prometheus.HistogramOpts{
+		Name:    "meshcore_queue_length_histogram",
+		Help:    "Distribution of sampled outbound packet queue lengths",
+		Buckets: []float64{0, 1, 2, 4, 8, 16, 32, 64},
+	}, []string{"node"})
+
+	NoiseFloorDBm = newGaugeVec(prometheus.GaugeOpts{
 		Name: "meshcore_noise_floor_dbm",
 		Help: "Radio noise floor in dBm",
 	}, []string{"node"})
 
-	LastRSSI = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	LastRSSI = newGaugeVec(prometheus.GaugeOpts{
 		Name: "meshcore_last_rssi_dbm",
 		Help: "Last received signal strength in dBm",
 	}, []string{"node"})
 
-	LastSNR = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	LastSNR = newGaugeVec(prometheus.GaugeOpts{
 		Name: "meshcore_last_snr_db",
 		Help: "Last signal-to-noise ratio in dB",
 	}, []string{"node"})
 
-	TxAirtimeSeconds = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	RemoteLinkRxRSSI = newGaugeVec(prometheus.GaugeOpts{
+		Name: "meshcore_remote_link_rx_rssi_dbm",
+		Help: "RSSI the companion radio measured on the repeater's last status response",
+	}, []string{"node"})
+
+	RemoteLinkRxSNR = newGaugeVec(prometheus.GaugeOpts{
+		Name: "meshcore_remote_link_rx_snr_db",
+		Help: "SNR the companion radio measured on the repeater's last status response",
+	}, []string{"node"})
+
+	TxAirtimeSeconds = newGaugeVec(prometheus.GaugeOpts{
 		Name: "meshcore_tx_airtime_seconds_total",
 		Help: "Cumulative transmit airtime in seconds",
 	}, []string{"node"})
 
-	RxAirtimeSeconds = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	RxAirtimeSeconds = newGaugeVec(prometheus.GaugeOpts{
 		Name: "meshcore_rx_airtime_seconds_total",
 		Help: "Cumulative receive airtime in seconds",
 	}, []string{"node"})
 
-	PacketsReceived = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	PacketsReceived = newGaugeVec(prometheus.GaugeOpts{
 		Name: "meshcore_packets_received_total",
 		Help: "Total packets received",
 	}, []string{"node"})
 
-	PacketsSent = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	PacketsSent = newGaugeVec(prometheus.GaugeOpts{
 		Name: "meshcore_packets_sent_total",
 		Help: "Total packets sent",
 	}, []string{"node"})
 
-	PacketsFloodTx = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	PacketsFloodTx = newGaugeVec(prometheus.GaugeOpts{
 		Name: "meshcore_packets_flood_tx_total",
 		Help: "Packets sent via flood routing",
 	}, []string{"node"})
 
-	PacketsDirectTx = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	PacketsDirectTx = newGaugeVec(prometheus.GaugeOpts{
 		Name: "meshcore_packets_direct_tx_total",
 		Help: "Packets sent via direct routing",
 	}, []string{"node"})
 
-	PacketsFloodRx = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	PacketsFloodRx = newGaugeVec(prometheus.GaugeOpts{
 		Name: "meshcore_packets_flood_rx_total",
 		Help: "Packets received via flood routing",
 	}, []string{"node"})
 
-	PacketsDirectRx = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	PacketsDirectRx = newGaugeVec(prometheus.GaugeOpts{
 		Name: "meshcore_packets_direct_rx_total",
 		Help: "Packets received via direct routing",
 	}, []string{"node"})
 
-	ScrapeErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+	// PacketsCounted follows the packet gauges above as a true counter: it
+	// only grows, and a radio reboot resetting the firmware counters adds
+	// the packets counted since boot instead of going down.
+	PacketsCounted = newCounterVec(prometheus.CounterOpts{
+		Name: "meshcore_packets_counted_total",
+		Help: "Packets counted by the exporter from the radio's packet stats, by counter; never decreases across radio reboots",
+	}, []string{"node", "counter"})
+
+	FloodRatioTx = newGaugeVec(prometheus.GaugeOpts{
+		Name: "meshcore_flood_ratio_tx",
+		Help: "Fraction of sent packets that used flood rather than direct routing",
+	}, []string{"node"})
+
+	FloodRatioRx = newGaugeVec(prometheus.GaugeOpts{
+		Name: "meshcore_flood_ratio_rx",
+		Help: "Fraction of received packets that used flood rather than direct routing",
+	}, []string{"node"})
+
+	// Freshness metrics: when each group of values was last read from the radio
+	CoreStatsUpdated = newGaugeVec(prometheus.GaugeOpts{
+		Name: "meshcore_core_stats_updated_timestamp_seconds",
+		Help: "Unix time battery, uptime and queue metrics were last read from the node",
+	}, []string{"node"})
+
+	RadioStatsUpdated = newGaugeVec(prometheus.GaugeOpts{
+		Name: "meshcore_radio_stats_updated_timestamp_seconds",
+		Help: "Unix time RSSI, SNR, noise floor and airtime metrics were last read from the node",
+	}, []string{"node"})
+
+	PacketStatsUpdated = newGaugeVec(prometheus.GaugeOpts{
+		Name: "meshcore_packet_stats_updated_timestamp_seconds",
+		Help: "Unix time packet counters were last read from the node",
+	}, []string{"node"})
+
+	TelemetryVoltage = newGaugeVec(prometheus.GaugeOpts{
+		Name: "meshcore_telemetry_voltage",
+		Help: "Voltage reported in node telemetry, by LPP channel",
+	}, []string{"node", "channel"})
+
+	TelemetryTemperature = newGaugeVec(prometheus.GaugeOpts{
+		Name: "meshcore_telemetry_temperature_celsius",
+		Help: "Temperature reported in node telemetry, by LPP channel",
+	}, []string{"node", "channel"})
+
+	TelemetryHumidity = newGaugeVec(prometheus.GaugeOpts{
+		Name: "meshcore_telemetry_humidity_percent",
+		Help: "Relative humidity reported in node telemetry, by LPP channel",
+	}, []string{"node", "channel"})
+
+	TelemetryPressure = newGaugeVec(prometheus.GaugeOpts{
+		Name: "meshcore_telemetry_pressure_hpa",
+		Help: "Barometric pressure reported in node telemetry, by LPP channel",
+	}, []string{"node", "channel"})
+
+	TelemetryCurrent = newGaugeVec(prometheus.GaugeOpts{
+		Name: "meshcore_telemetry_current_amperes",
+		Help: "Current reported in node telemetry, by LPP channel",
+	}, []string{"node", "channel"})
+
+	TelemetryUpdated = newGaugeVec(prometheus.GaugeOpts{
+		Name: "meshcore_telemetry_updated_timestamp_seconds",
+		Help: "Unix time telemetry was last read from the node",
+	}, []string{"node"})
+
+	ScrapeErrors = newCounterVec(prometheus.CounterOpts{
 		Name: "meshcore_scrape_errors_total",
 		Help: "Total number of scrape errors",
 	}, []string{"node"})
 
-	LoginStatus = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	CommandDuration = newHistogramVec(prometheus.HistogramOpts{
+		Name:    "meshcore_command_duration_seconds",
+		Help:    "Time from sending a command to its last response frame, or spent waiting for a push (wait_<push>), for successful exchanges",
+		Buckets: []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	}, []string{"node", "command"})
+
+	ParseErrors = newCounterVec(prometheus.CounterOpts{
+		Name: "meshcore_parse_errors_total",
+		Help: "Frames from the radio that failed to decode, by parser",
+	}, []string{"node", "parser"})
+
+	ImplausibleReadings = newCounterVec(prometheus.CounterOpts{
+		Name: "meshcore_implausible_readings_total",
+		Help: "Stats readings dropped because counters jumped implausibly since the previous scrape",
+	}, []string{"node"})
+
+	LoginStatus = newGaugeVec(prometheus.GaugeOpts{
 		Name: "meshcore_login_status",
 		Help: "Login status (1=logged in, 0=not logged in)",
 	}, []string{"node"})
 
+	LoginPasswordIndex = newGaugeVec(prometheus.GaugeOpts{
+		Name: "meshcore_login_password_index",
+		Help: "Position (from 0) in the -password list of the password the last successful login used",
+	}, []string{"node"})
+
 	// Mesh traffic metrics (from push log data)
-	MeshPacketsObserved = promauto.NewCounterVec(prometheus.CounterOpts{
+	MeshPacketsObserved = newCounterVec(prometheus.CounterOpts{
 		Name: "meshcore_mesh_packets_observed_total",
 		Help: "Mesh packets observed by the repeater",
-	}, []string{"node", "sender"})
+	}, []string{"node", "sender", "route", "type"})
+
+	MeshPacketsDuplicate = newCounterVec(prometheus.CounterOpts{
+		Name: "meshcore_mesh_packets_duplicate_total",
+		Help: "Repeats of already observed mesh packets, not counted in meshcore_mesh_packets_observed_total",
+	}, []string{"node"})
 
-	MeshPacketRSSI = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	MeshPacketRSSI = newGaugeVec(prometheus.GaugeOpts{
 		Name: "meshcore_mesh_packet_rssi_dbm",
 		Help: "Last RSSI of packets from a mesh sender",
 	}, []string{"node", "sender"})
 
-	MeshPacketSNR = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	MeshPacketSNR = newGaugeVec(prometheus.GaugeOpts{
 		Name: "meshcore_mesh_packet_snr_db",
 		Help: "Last SNR of packets from a mesh sender",
 	}, []string{"node", "sender"})
 
-	MeshPacketBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+	MeshPacketRSSIHistogram = newHistogramVec(prometheus.HistogramOpts{
+		Name:    "meshcore_mesh_packet_rssi_histogram",
+		Help:    "Distribution of RSSI (dBm) of packets from a mesh sender",
+		Buckets: prometheus.LinearBuckets(-130, 10, 10), // -130 to -40
+	}, []string{"node", "sender"})
+
+	MeshPacketSNRHistogram = newHistogramVec(prometheus.HistogramOpts{
+		Name:    "meshcore_mesh_packet_snr_histogram",
+		Help:    "Distribution of SNR (dB) of packets from a mesh sender",
+		Buckets: prometheus.LinearBuckets(-20, 2.5, 15), // -20 to +15
+	}, []string{"node", "sender"})
+
+	MeshPacketBytes = newCounterVec(prometheus.CounterOpts{
 		Name: "meshcore_mesh_packet_bytes_total",
 		Help: "Total bytes observed from mesh senders",
 	}, []string{"node", "sender"})
 
-	RepeaterLogins = promauto.NewCounterVec(prometheus.CounterOpts{
+	MeshSenderFirstSeen = newGaugeVec(prometheus.GaugeOpts{
+		Name: "meshcore_mesh_sender_first_seen_seconds",
+		Help: "Unix time a packet from a mesh sender was first observed by this process",
+	}, []string{"node", "sender"})
+
+	MeshSenderLastSeen = newGaugeVec(prometheus.GaugeOpts{
+		Name: "meshcore_mesh_sender_last_seen_seconds",
+		Help: "Unix time a packet from a mesh sender was last observed",
+	}, []string{"node", "sender"})
+
+	RepeaterLogins = newCounterVec(prometheus.CounterOpts{
 		Name: "meshcore_repeater_logins_total",
 		Help: "Total successful repeater logins",
 	}, []string{"node"})
 
-	RadioReboots = promauto.NewCounterVec(prometheus.CounterOpts{
+	LoginFailures = newCounterVec(prometheus.CounterOpts{
+		Name: "meshcore_login_failures_total",
+		Help: "Repeater logins rejected, by the reason in the login fail push",
+	}, []string{"node", "reason"})
+
+	RadioReboots = newCounterVec(prometheus.CounterOpts{
 		Name: "meshcore_radio_reboots_total",
 		Help: "Total companion radio reboot commands sent",
 	}, []string{"node"})
 
-	SerialReconnects = promauto.NewCounterVec(prometheus.CounterOpts{
+	SerialReconnects = newCounterVec(prometheus.CounterOpts{
 		Name: "meshcore_serial_reconnects_total",
 		Help: "Total serial port reconnections",
 	}, []string{"node"})
 
+	SerialInfo = newGaugeVec(prometheus.GaugeOpts{
+		Name: "meshcore_serial_info",
+		Help: "Serial port configuration in use (always 1)",
+	}, []string{"port", "baud"})
+
+	ContactsByType = newGaugeVec(prometheus.GaugeOpts{
+		Name: "meshcore_contacts_by_type",
+		Help: "Number of contacts stored on the companion radio, by advertised node type",
+	}, []string{"node", "type"})
+
+	ContactPathLength = newGaugeVec(prometheus.GaugeOpts{
+		Name: "meshcore_contact_path_length",
+		Help: "Hops on the companion's stored out path to each contact (-1 when no direct path is known)",
+	}, []string{"node", "contact"})
+
+	ContactDistanceKm = newGaugeVec(prometheus.GaugeOpts{
+		Name: "meshcore_contact_distance_km",
+		Help: "Great-circle distance from the companion radio to each contact with a known position",
+	}, []string{"node", "contact"})
+
+	RepeaterInfo = newGaugeVec(prometheus.GaugeOpts{
+		Name: "meshcore_repeater_info",
+		Help: "Firmware version, name and owner info reported by the repeater (always 1)",
+	}, []string{"node", "version", "name", "owner"})
+
+	Up = newGaugeVec(prometheus.GaugeOpts{
+		Name: "meshcore_up",
+		Help: "Whether the last collection cycle read every requested stats type (1) or not (0)",
+	}, []string{"node"})
+
+	BuildInfo = newGaugeVec(prometheus.GaugeOpts{
+		Name: "meshcore_exporter_build_info",
+		Help: "Exporter build that is running (always 1)",
+	}, []string{"version", "commit", "goversion"})
+
+	FirmwareInfo = newGaugeVec(prometheus.GaugeOpts{
+		Name: "meshcore_radio_firmware_info",
+		Help: "Firmware version reported by the companion radio (always 1)",
+	}, []string{"node", "version"})
+
+	ResyncEvents = newCounterVec(prometheus.CounterOpts{
+		Name: "meshcore_resync_events_total",
+		Help: "Times the serial stream was resynchronized after an invalid frame header",
+	}, []string{"node"})
+
+	SerialDowntime = newGaugeVec(prometheus.GaugeOpts{
+		Name: "meshcore_serial_downtime_seconds",
+		Help: "Duration of the most recent serial outage in seconds",
+	}, []string{"node"})
+
+	SerialOutageDuration = newHistogramVec(prometheus.HistogramOpts{
+		Name:    "meshcore_serial_outage_duration_seconds",
+		Help:    "Distribution of serial outage durations from first failure to successful reconnect",
+		Buckets: []float64{5, 10, 30, 60, 120, 300, 600, 1800, 3600},
+	}, []string{"node"})
+
+	AdvertsSent = newCounterVec(prometheus.CounterOpts{
+		Name: "meshcore_adverts_sent_total",
+		Help: "Self adverts the companion radio accepted for broadcast",
+	}, []string{"node"})
+
+	MessagesDelivered = newCounterVec(prometheus.CounterOpts{
+		Name: "meshcore_messages_delivered_total",
+		Help: "Delivery acks received for messages sent by the companion radio",
+	}, []string{"node"})
+
+	IdentityChanges = newCounterVec(prometheus.CounterOpts{
+		Name: "meshcore_identity_changes_total",
+		Help: "Times the companion radio reported a different public key than before",
+	}, []string{"node"})
+
+	// LoRa modulation metrics derived from the radio's configured parameters
+	LoRaSymbolTime = newGaugeVec(prometheus.GaugeOpts{
+		Name: "meshcore_lora_symbol_time_seconds",
+		Help: "LoRa symbol time in seconds for the configured bandwidth and spreading factor",
+	}, []string{"node"})
+
+	LoRaBitrate = newGaugeVec(prometheus.GaugeOpts{
+		Name: "meshcore_lora_bitrate_bps",
+		Help: "Nominal LoRa bitrate in bits per second for the configured modulation",
+	}, []string{"node"})
+
+	RadioFreqKHz = newGaugeVec(prometheus.GaugeOpts{
+		Name: "meshcore_radio_freq_khz",
+		Help: "LoRa frequency the companion radio is configured for, in kHz",
+	}, []string{"node"})
+
+	RadioBandwidthHz = newGaugeVec(prometheus.GaugeOpts{
+		Name: "meshcore_radio_bandwidth_hz",
+		Help: "LoRa bandwidth the companion radio is configured for, in Hz",
+	}, []string{"node"})
+
+	RadioSpreadingFactor = newGaugeVec(prometheus.GaugeOpts{
+		Name: "meshcore_radio_spreading_factor",
+		Help: "LoRa spreading factor the companion radio is configured for",
+	}, []string{"node"})
+
+	RadioCodingRate = newGaugeVec(prometheus.GaugeOpts{
+		Name: "meshcore_radio_coding_rate",
+		Help: "LoRa coding rate denominator (4/CR) the companion radio is configured for",
+	}, []string{"node"})
+
+	TxPowerDBm = newGaugeVec(prometheus.GaugeOpts{
+		Name: "meshcore_tx_power_dbm",
+		Help: "TX power the companion radio is configured for, in dBm",
+	}, []string{"node"})
+
+	MaxTxPowerDBm = newGaugeVec(prometheus.GaugeOpts{
+		Name: "meshcore_max_tx_power_dbm",
+		Help: "Highest TX power the companion radio supports, in dBm",
+	}, []string{"node"})
+
+	ContactsCapacity = newGaugeVec(prometheus.GaugeOpts{
+		Name: "meshcore_contacts_capacity",
+		Help: "Maximum number of contacts the companion radio can store",
+	}, []string{"node"})
+
+	ContactsUsed = newGaugeVec(prometheus.GaugeOpts{
+		Name: "meshcore_contacts_used",
+		Help: "Number of contacts stored on the companion radio",
+	}, []string{"node"})
+
+	ContactsFetchProgress = newGaugeVec(prometheus.GaugeOpts{
+		Name: "meshcore_contacts_fetch_progress",
+		Help: "Fraction of contacts received in the current or last contact download",
+	}, []string{"node"})
+
 	// Node position metrics
-	NodeLatitude = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	NodeLatitude = newGaugeVec(prometheus.GaugeOpts{
 		Name: "meshcore_node_latitude",
 		Help: "Node latitude in degrees",
 	}, []string{"node"})
 
-	NodeLongitude = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	NodeLongitude = newGaugeVec(prometheus.GaugeOpts{
 		Name: "meshcore_node_longitude",
 		Help: "Node longitude in degrees",
 	}, []string{"node"})
-
-
 )
+
+// MeshSenderSeries returns the metrics with a series per mesh sender, for
+// pruning senders that have gone quiet.
+func MeshSenderSeries() []interface {
+	DeletePartialMatch(prometheus.Labels) int
+} {
+	return []interface {
+		DeletePartialMatch(prometheus.Labels) int
+	}{
+		MeshPacketsObserved,
+		MeshPacketRSSI,
+		MeshPacketSNR,
+		MeshPacketRSSIHistogram,
+		MeshPacketSNRHistogram,
+		MeshPacketBytes,
+		MeshSenderFirstSeen,
+		MeshSenderLastSeen,
+	}
+}
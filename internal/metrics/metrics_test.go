@@ -0,0 +1,26 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/watsoncj/meshcore-stats/transform"
+)
+
+func TestTransformAppliedOnSet(t *testing.T) {
+	transform.Register(func(name string, labels map[string]string, v float64) float64 {
+		if name == "meshcore_battery_millivolts" && labels["node"] == "calibrated" {
+			return v + 150
+		}
+		return v
+	})
+
+	BatteryMillivolts.WithLabelValues("calibrated").Set(3950)
+	if got := testutil.ToFloat64(BatteryMillivolts.WithLabelValues("calibrated")); got != 4100 {
+		t.Errorf("calibrated battery = %v, want 4100", got)
+	}
+	BatteryMillivolts.WithLabelValues("other").Set(3950)
+	if got := testutil.ToFloat64(BatteryMillivolts.WithLabelValues("other")); got != 3950 {
+		t.Errorf("untargeted battery = %v, want 3950", got)
+	}
+}
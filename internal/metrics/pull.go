@@ -0,0 +1,52 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// pullCollector refreshes the exporter metrics when they are scraped rather
+// than on a timer. Every metric sits behind the one collector, so a refresh
+// finishes before any of them is read.
+type pullCollector struct {
+	refresh func()
+	maxAge  time.Duration
+	cs      []prometheus.Collector
+
+	mu   sync.Mutex
+	last time.Time
+}
+
+// RegisterPull registers the same metrics as Register, but each scrape first
+// calls refresh to read fresh values from the radio. Scrapes within maxAge
+// of the last refresh reuse its values, so several Prometheus servers (or a
+// retry) don't each wake the radio. refresh must return within the scrape
+// timeout; if it gives up on the radio, the scrape serves the values already
+// held.
+func RegisterPull(reg prometheus.Registerer, enabled, disabled []string, refresh func(), maxAge time.Duration) error {
+	cs, err := selected(enabled, disabled)
+	if err != nil {
+		return err
+	}
+	return reg.Register(&pullCollector{refresh: refresh, maxAge: maxAge, cs: cs})
+}
+
+func (p *pullCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, c := range p.cs {
+		c.Describe(ch)
+	}
+}
+
+func (p *pullCollector) Collect(ch chan<- prometheus.Metric) {
+	p.mu.Lock()
+	if time.Since(p.last) >= p.maxAge {
+		p.refresh()
+		p.last = time.Now()
+	}
+	p.mu.Unlock()
+	for _, c := range p.cs {
+		c.Collect(ch)
+	}
+}
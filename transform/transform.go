@@ -0,0 +1,53 @@
+// Package transform lets code embedding the exporter adjust metric values,
+// for calibration offsets or unit conversions specific to a piece of
+// hardware, as they are published rather than on every scrape.
+package transform
+
+import "sync"
+
+// Func adjusts a value before it is published. name is the full metric name
+// as listed in the README (e.g. "meshcore_battery_millivolts") and labels are
+// the series' own labels, without any added by -extra-labels.
+//
+// Gauge values are passed through as they are set and counter increments as
+// they are added; Inc and histogram observations are left alone.
+type Func func(name string, labels map[string]string, value float64) float64
+
+var (
+	mu    sync.RWMutex
+	funcs []Func
+)
+
+// Register adds fn to the transforms applied to every published value, after
+// any registered before it. Register before the exporter starts collecting.
+// For example, to correct a battery ADC that reads 150 mV low:
+//
+//	transform.Register(func(name string, _ map[string]string, v float64) float64 {
+//		if name == "meshcore_battery_millivolts" {
+//			return v + 150
+//		}
+//		return v
+//	})
+func Register(fn Func) {
+	mu.Lock()
+	defer mu.Unlock()
+	funcs = append(funcs, fn)
+}
+
+// Enabled reports whether any transform is registered, so callers can skip
+// building labels when there is nothing to apply.
+func Enabled() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return len(funcs) > 0
+}
+
+// Apply passes value through every registered transform in turn.
+func Apply(name string, labels map[string]string, value float64) float64 {
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, fn := range funcs {
+		value = fn(name, labels, value)
+	}
+	return value
+}